@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by a CircuitBreakerDB while it is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerConfig configures a CircuitBreakerDB.
+type BreakerConfig struct {
+	// Threshold is the number of consecutive connection failures that opens the
+	// breaker. Defaults to 5.
+	Threshold int
+	// OpenTimeout is how long the breaker stays open before a single call is let
+	// through to probe the database. Defaults to 30 seconds.
+	OpenTimeout time.Duration
+}
+
+// CircuitBreakerDB is a DB that stops sending queries after repeated connection
+// failures, returning ErrCircuitOpen immediately instead. After OpenTimeout a single
+// call probes the database, closing the breaker if it succeeds. Only connection
+// errors as reported by IsConnectionError count as failures, query errors such as
+// store.ErrNotFound or constraint violations do not.
+type CircuitBreakerDB struct {
+	db  DB
+	cfg BreakerConfig
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+var _ DB = (*CircuitBreakerDB)(nil)
+
+// NewCircuitBreakerDB returns a DB wrapping db with a circuit breaker.
+func NewCircuitBreakerDB(db DB, cfg BreakerConfig) *CircuitBreakerDB {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	return &CircuitBreakerDB{db: db, cfg: cfg}
+}
+
+// WithCircuitBreaker returns db wrapped with a circuit breaker, for use where only a
+// DB is needed. Use NewCircuitBreakerDB to check Open.
+func WithCircuitBreaker(db DB, cfg BreakerConfig) DB {
+	return NewCircuitBreakerDB(db, cfg)
+}
+
+func (b *CircuitBreakerDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	probe, err := b.allow()
+	if err != nil {
+		return err
+	}
+	err = b.db.GetContext(ctx, dest, query, args...)
+	b.done(probe, err)
+	return err
+}
+
+func (b *CircuitBreakerDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	probe, err := b.allow()
+	if err != nil {
+		return err
+	}
+	err = b.db.SelectContext(ctx, dest, query, args...)
+	b.done(probe, err)
+	return err
+}
+
+func (b *CircuitBreakerDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	probe, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+	result, err := b.db.ExecContext(ctx, query, args...)
+	b.done(probe, err)
+	return result, err
+}
+
+// InTransaction returns true if the wrapped DB is a transaction.
+func (b *CircuitBreakerDB) InTransaction() bool {
+	return inTransaction(b.db)
+}
+
+// Open returns true if the breaker is open and calls are failing fast.
+func (b *CircuitBreakerDB) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.cfg.Threshold
+}
+
+// allow returns ErrCircuitOpen if the call should not be sent to the database. It
+// returns true if the call is the probe of an open breaker.
+func (b *CircuitBreakerDB) allow() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.cfg.Threshold {
+		return false, nil
+	}
+	if b.probing || time.Since(b.openedAt) < b.cfg.OpenTimeout {
+		return false, ErrCircuitOpen
+	}
+	b.probing = true
+	return true, nil
+}
+
+// done records the result of a call sent to the database. Only the probe clears
+// probing and closes an open breaker, so a call sent before the breaker opened
+// neither lets a second probe through nor closes it.
+func (b *CircuitBreakerDB) done(probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if !IsConnectionError(err) {
+		if probe || b.failures < b.cfg.Threshold {
+			b.failures = 0
+		}
+		return
+	}
+	b.failures++
+	if probe || b.failures == b.cfg.Threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// IsConnectionError returns true if the error means the database could not be
+// reached or the connection was lost, rather than the query failing.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	switch code := SQLState(err); {
+	case strings.HasPrefix(code, "08"): // connection exception
+		return true
+	case code == "53300", code == "57P01", code == "57P02", code == "57P03":
+		// too many connections, admin shutdown, crash shutdown, cannot connect now
+		return true
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	b := NewCircuitBreakerDB(nil, BreakerConfig{Threshold: 1, OpenTimeout: time.Millisecond})
+
+	// A call is sent while the breaker is closed and finishes after the probe starts.
+	inFlight, err := b.allow()
+	if err != nil {
+		t.Fatalf("allow closed: %v", err)
+	}
+	b.done(false, driver.ErrBadConn)
+	if !b.Open() {
+		t.Fatal("breaker not open after threshold failures")
+	}
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow open: got %v, want ErrCircuitOpen", err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	probe, err := b.allow()
+	if err != nil || !probe {
+		t.Fatalf("allow after timeout: got probe %v err %v, want the probe", probe, err)
+	}
+	b.done(inFlight, driver.ErrBadConn)
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow while probing: got %v, want ErrCircuitOpen", err)
+	}
+
+	b.done(probe, nil)
+	if b.Open() {
+		t.Fatal("breaker open after successful probe")
+	}
+	if probe, err := b.allow(); err != nil || probe {
+		t.Fatalf("allow after close: got probe %v err %v", probe, err)
+	}
+}
+
+func TestCircuitBreakerStragglerDoesNotClose(t *testing.T) {
+	b := NewCircuitBreakerDB(nil, BreakerConfig{Threshold: 1, OpenTimeout: time.Hour})
+
+	// A call is sent while the breaker is closed and succeeds after it opened.
+	inFlight, err := b.allow()
+	if err != nil {
+		t.Fatalf("allow closed: %v", err)
+	}
+	b.done(false, driver.ErrBadConn)
+	b.done(inFlight, nil)
+	if !b.Open() {
+		t.Fatal("breaker closed by a call sent before it opened")
+	}
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow open: got %v, want ErrCircuitOpen", err)
+	}
+}
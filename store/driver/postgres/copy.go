@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CopyConn is the copy interface implemented by *pgxpool.Pool, *pgx.Conn and pgx.Tx.
+type CopyConn interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// CopyFrom inserts the records using the postgres COPY protocol, which is the fastest
+// way to load a large number of rows. Only the fields bound by the Insert are copied
+// and their values are copied as is, the Insert expression is not applied. Fields
+// binding more than one argument are not supported. It returns the number of rows
+// copied. The records are not updated with the inserted values.
+func (t *Table[T]) CopyFrom(ctx context.Context, conn CopyConn, records []*T) (rows int64, err error) {
+	if Observer != nil {
+		defer t.observe("CopyFrom", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "CopyFrom")
+	defer func() { span.End(err) }()
+
+	var columns []string
+	for _, field := range t.Fields {
+		switch t.argCount(field, writeInsert) {
+		case 0:
+		case 1:
+			columns = append(columns, copyIdentifier(field.Name))
+		default:
+			return 0, fmt.Errorf("field %s binds more than one argument, which copy does not support", field.Name)
+		}
+	}
+	if len(columns) == 0 {
+		return 0, errors.New("no fields bind an argument to copy")
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	tableName := pgx.Identifier{copyIdentifier(t.Table)}
+	if t.Schema != "" {
+		tableName = pgx.Identifier{copyIdentifier(t.Schema), copyIdentifier(t.Table)}
+	}
+	rows, err = conn.CopyFrom(ctx, tableName, columns, pgx.CopyFromSlice(len(records), func(i int) ([]any, error) {
+		return t.writeArgs(records[i], writeInsert, nil)
+	}))
+	if err != nil {
+		return 0, wrapQueryError(ctx, err)
+	}
+	return rows, nil
+}
+
+// copyIdentifier returns the name postgres resolves the identifier to, as pgx quotes
+// the names it copies to. Quoted identifiers are unquoted and unquoted identifiers
+// are folded to lower case, like the generated queries that use them as written.
+func copyIdentifier(name string) string {
+	if len(name) >= 2 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	}
+	return strings.ToLower(name)
+}
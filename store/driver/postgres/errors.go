@@ -1,10 +1,15 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 
 	"github.com/evertonbiviatello/go-commons/store"
 	"github.com/jackc/pgconn"
+	pgconnv5 "github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
 )
 
 // Lookup of postgres error codes to basic errors we can return to a user
@@ -15,18 +20,86 @@ var pgErrorCodeToStoreErrorType = map[string]store.ErrorType{
 	"23514": store.ErrorTypeInvalid,
 }
 
+// Error codes postgres returns that are not constraint violations.
+const (
+	// pgQueryCanceled is returned when a statement is cancelled.
+	pgQueryCanceled = "57014"
+	// pgSerializationFailure is returned when a transaction could not be serialized.
+	pgSerializationFailure = "40001"
+	// pgDeadlockDetected is returned when a transaction is aborted to resolve a deadlock.
+	pgDeadlockDetected = "40P01"
+)
+
+// WrapError translates database errors into store errors. No rows becomes
+// store.ErrNotFound and constraint violations become a *store.ConstraintError.
+// A statement cancelled by postgres is wrapped with store.ErrTimeout, which is
+// distinct from the context errors, a statement cancelled because the context of
+// the call was done is reported with the context error by the Table methods.
+// Deadlocks and serialization failures are wrapped with store.ErrDeadlock and
+// store.ErrSerialization.
 func WrapError(err error) error {
-	if err == sql.ErrNoRows {
+	if errors.Is(err, sql.ErrNoRows) {
 		return store.ErrNotFound
 	}
-	switch e := err.(type) {
-	case *pgconn.PgError:
-		if et, found := pgErrorCodeToStoreErrorType[e.Code]; found {
-			return &store.Error{
-				Type: et,
-				Err:  err,
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	switch SQLState(err) {
+	case pgQueryCanceled:
+		return fmt.Errorf("%w: %w", store.ErrTimeout, err)
+	case pgDeadlockDetected:
+		return fmt.Errorf("%w: %w", store.ErrDeadlock, err)
+	case pgSerializationFailure:
+		return fmt.Errorf("%w: %w", store.ErrSerialization, err)
+	}
+	if code, constraint, column, ok := pgErrorDetails(err); ok {
+		if et, found := pgErrorCodeToStoreErrorType[code]; found {
+			return &store.ConstraintError{
+				Type:       et,
+				Constraint: constraint,
+				Column:     column,
+				Err:        err,
 			}
 		}
 	}
 	return err
 }
+
+// wrapQueryError wraps err with WrapError. If ctx is done, the context error is
+// also wrapped so a timeout can be checked with errors.Is(err, context.DeadlineExceeded)
+// whichever driver is used.
+func wrapQueryError(ctx context.Context, err error) error {
+	// The driver cancels the statement when ctx is done, report why.
+	if ctxErr := ctx.Err(); ctxErr != nil && SQLState(err) == pgQueryCanceled {
+		return fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	err = WrapError(err)
+	if ctxErr := ctx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+		return fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	return err
+}
+
+// SQLState returns the postgres SQLSTATE error code from a pgx or pq error
+// anywhere in the chain. It returns an empty string if there is none.
+func SQLState(err error) string {
+	code, _, _, _ := pgErrorDetails(err)
+	return code
+}
+
+// pgErrorDetails extracts the error code, constraint and column from a pgx or pq error.
+func pgErrorDetails(err error) (code, constraint, column string, ok bool) {
+	var pgErrV5 *pgconnv5.PgError
+	if errors.As(err, &pgErrV5) {
+		return pgErrV5.Code, pgErrV5.ConstraintName, pgErrV5.ColumnName, true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code, pgErr.ConstraintName, pgErr.ColumnName, true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code), pqErr.Constraint, pqErr.Column, true
+	}
+	return "", "", "", false
+}
@@ -0,0 +1,105 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/evertonbiviatello/go-commons/store"
+	"github.com/evertonbiviatello/go-commons/store/driver/postgres"
+	"github.com/evertonbiviatello/go-commons/store/driver/postgres/pgtest"
+	"github.com/jackc/pgconn"
+	pgconnv5 "github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+// cancelledQuery simulates the driver cancelling a running statement when the
+// context is done, returning err.
+func cancelledQuery(err error) func(context.Context, interface{}, string, ...interface{}) error {
+	return func(ctx context.Context, _ interface{}, _ string, _ ...interface{}) error {
+		<-ctx.Done()
+		return err
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	queryCanceled := &pq.Error{Code: "57014", Message: "canceling statement due to user request"}
+	tests := []struct {
+		name    string
+		driver  error
+		timeout bool
+		wantErr error
+		notWant error
+	}{
+		{name: "cancel pg error", driver: queryCanceled, wantErr: context.Canceled, notWant: store.ErrTimeout},
+		{name: "cancel context error", driver: context.Canceled, wantErr: context.Canceled},
+		{name: "deadline pg error", driver: queryCanceled, timeout: true, wantErr: context.DeadlineExceeded, notWant: store.ErrTimeout},
+		{name: "deadline context error", driver: context.DeadlineExceeded, timeout: true, wantErr: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := newUserTable(t)
+			db := pgtest.NewRecordingDB()
+			db.GetFunc = cancelledQuery(tt.driver)
+
+			var opts []postgres.QueryOption
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.timeout {
+				opts = append(opts, postgres.QueryOptionTimeout(time.Millisecond))
+			} else {
+				time.AfterFunc(time.Millisecond, cancel)
+			}
+
+			_, err := table.GetByIDWithOpts(ctx, db, []interface{}{1}, opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.notWant != nil && errors.Is(err, tt.notWant) {
+				t.Errorf("error = %v, should not be %v", err, tt.notWant)
+			}
+		})
+	}
+}
+
+func TestWrapErrorStatementTimeout(t *testing.T) {
+	err := postgres.WrapError(&pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"})
+	if !errors.Is(err, store.ErrTimeout) {
+		t.Errorf("error = %v, want store.ErrTimeout", err)
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, should not be a context error", err)
+	}
+}
+
+func TestWrapErrorTransactionConflicts(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"pq deadlock", &pq.Error{Code: "40P01"}, store.ErrDeadlock},
+		{"pq serialization", &pq.Error{Code: "40001"}, store.ErrSerialization},
+		{"pgconn deadlock", &pgconn.PgError{Code: "40P01"}, store.ErrDeadlock},
+		{"pgx v5 serialization", &pgconnv5.PgError{Code: "40001"}, store.ErrSerialization},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := postgres.WrapError(tt.err)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("WrapError = %v, want %v", err, tt.want)
+			}
+			if postgres.SQLState(err) != postgres.SQLState(tt.err) {
+				t.Errorf("SQLState = %q, want the driver error to still be wrapped", postgres.SQLState(err))
+			}
+			if !postgres.IsRetriable(err) || !postgres.IsRetriable(tt.err) {
+				t.Errorf("IsRetriable = false, want true")
+			}
+		})
+	}
+
+	if err := postgres.WrapError(&pq.Error{Code: "23505"}); errors.Is(err, store.ErrDeadlock) || errors.Is(err, store.ErrSerialization) || postgres.IsRetriable(err) {
+		t.Errorf("unique violation %v is reported as a transaction conflict", err)
+	}
+}
@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/evertonbiviatello/go-commons/store"
+)
+
+// writeKeywords are the statements rejected by Explain since EXPLAIN ANALYZE executes them.
+var writeKeywords = []string{"INSERT", "UPDATE", "DELETE", "MERGE", "TRUNCATE"}
+
+// ExplainInsert returns the query and arguments Insert would execute for record
+// without running it. PreProcessRecord is run on the record as it would be.
+func (t *Table[T]) ExplainInsert(record *T, opts ...QueryOption) (string, []any, error) {
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return "", nil, fmt.Errorf("query option error: %w", err)
+		}
+	}
+	query, err := t.insertQuery(queryOptions)
+	if err != nil {
+		return "", nil, err
+	}
+	args, err := t.writeArgs(record, writeInsert, queryOptions.FieldValues)
+	if err != nil {
+		return "", nil, err
+	}
+	return query, args, nil
+
+}
+
+// ExplainUpdate returns the query and arguments Update would execute for record
+// without running it. PreProcessRecord is run on the record as it would be.
+func (t *Table[T]) ExplainUpdate(record *T, opts ...QueryOption) (string, []any, error) {
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return "", nil, fmt.Errorf("query option error: %w", err)
+		}
+	}
+	query, err := t.updateQuery(queryOptions)
+	if err != nil {
+		return "", nil, err
+	}
+	args, err := t.writeArgs(record, writeUpdate, queryOptions.FieldValues)
+	if err != nil {
+		return "", nil, err
+	}
+	return query, args, nil
+
+}
+
+// ExplainUpsert returns the query and arguments Upsert would execute for record
+// without running it. PreProcessRecord is run on the record as it would be.
+func (t *Table[T]) ExplainUpsert(record *T, opts ...QueryOption) (string, []any, error) {
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return "", nil, fmt.Errorf("query option error: %w", err)
+		}
+	}
+	query, err := t.upsertQuery(writeUpsert, 1, queryOptions)
+	if err != nil {
+		return "", nil, err
+	}
+	args, err := t.writeArgs(record, writeUpsert, queryOptions.FieldValues)
+	if err != nil {
+		return "", nil, err
+	}
+	return query, args, nil
+
+}
+
+// Explain runs the query with EXPLAIN (ANALYZE, BUFFERS, FORMAT TEXT) and returns the
+// plan, for example to check a query uses an index in a test. Since the query is
+// executed, only SELECT queries are allowed and anything that could write returns
+// an error.
+func (t *Table[T]) Explain(ctx context.Context, db DB, query string, args ...interface{}) (string, error) {
+
+	if !isReadQuery(query) {
+		return "", &store.Error{Type: store.ErrorTypeQuery, Err: errors.New("explain only supports SELECT queries")}
+	}
+	var plan []string
+	if err := db.SelectContext(ctx, &plan, "EXPLAIN (ANALYZE, BUFFERS, FORMAT TEXT) "+query, args...); err != nil {
+		return "", wrapQueryError(ctx, err)
+	}
+	return strings.Join(plan, "\n"), nil
+
+}
+
+// isReadQuery returns true if query is a SELECT, or a WITH query, that does not
+// contain a write statement.
+func isReadQuery(query string) bool {
+	fields := strings.FieldsFunc(strings.ToUpper(query), func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r == '_')
+	})
+	if len(fields) == 0 || (fields[0] != "SELECT" && fields[0] != "WITH") {
+		return false
+	}
+	for _, field := range fields {
+		if slices.Contains(writeKeywords, field) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,347 @@
+package postgres
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// JSON holds a value stored in a json or jsonb column. It implements sql.Scanner
+// and driver.Valuer so it can be used as a record field that is encoded and decoded
+// automatically. A NULL column decodes to the zero value.
+type JSON[F any] struct {
+	Val F
+}
+
+// Value encodes the value as JSON. It is passed as text so it converts to json
+// and jsonb with any driver.
+func (j JSON[F]) Value() (driver.Value, error) {
+	b, err := json.Marshal(j.Val)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode json: %w", err)
+	}
+	return string(b), nil
+}
+
+// Scan decodes a json or jsonb column.
+func (j *JSON[F]) Scan(src any) error {
+	var zero F
+	j.Val = zero
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, &j.Val)
+	case string:
+		return json.Unmarshal([]byte(v), &j.Val)
+	default:
+		return fmt.Errorf("cannot scan %T into JSON", src)
+	}
+}
+
+// JSONField returns a field for a json or jsonb column decoded into a record field of
+// any type F with getter and setter. The value is encoded from getter and bound with
+// a positional argument. The record must also have a string, []byte or
+// json.RawMessage field with the `db` tag of the column, or Init returns an error.
+// It is scanned with the encoded value and decoded into setter after every read, so
+// the F field should be tagged `db:"-"`. A NULL column decodes to the zero value. A
+// JSON[F] record field can be used with a plain Field instead.
+func JSONField[T, F any](name string, getter func(*T) F, setter func(*T, F)) *Field[T] {
+	rawIndex, rawErr := jsonRawIndex[T](name)
+	return &Field[T]{
+		err:    rawErr,
+		Name:   name,
+		Select: true,
+		Insert: Value,
+		Update: Value,
+		Value: func(record *T) (driver.Value, error) {
+			b, err := json.Marshal(getter(record))
+			if err != nil {
+				return nil, fmt.Errorf("could not encode json: %w", err)
+			}
+			return string(b), nil
+		},
+		Scan: func(record *T) error {
+			if rawErr != nil {
+				return rawErr
+			}
+			var value F
+			raw, ok := fieldByIndex(reflect.ValueOf(record).Elem(), rawIndex)
+			if ok {
+				var b []byte
+				if raw.Kind() == reflect.String {
+					b = []byte(raw.String())
+				} else {
+					b = raw.Bytes()
+				}
+				if len(b) > 0 {
+					if err := json.Unmarshal(b, &value); err != nil {
+						return fmt.Errorf("could not decode json: %w", err)
+					}
+				}
+			}
+			setter(record, value)
+			return nil
+		},
+	}
+}
+
+// jsonRawIndex returns the index of the string or []byte field of T tagged with
+// the column name, which the encoded value of a JSONField is scanned into.
+func jsonRawIndex[T any](name string) ([]int, error) {
+	column := strings.Trim(name, `"`)
+	for _, sf := range reflect.VisibleFields(reflect.TypeOf((*T)(nil)).Elem()) {
+		tag, _, _ := strings.Cut(sf.Tag.Get("db"), ",")
+		if tag != column || !sf.IsExported() {
+			continue
+		}
+		if sf.Type.Kind() == reflect.String || (sf.Type.Kind() == reflect.Slice && sf.Type.Elem().Kind() == reflect.Uint8) {
+			return sf.Index, nil
+		}
+		return nil, fmt.Errorf("json field %s must be scanned into a string or []byte field, not %s", name, sf.Type)
+	}
+	return nil, fmt.Errorf("json field %s has no string or []byte record field tagged db:%q", name, column)
+}
+
+// Array holds the value of a postgres array column such as text[] or bigint[]. It
+// implements sql.Scanner and driver.Valuer using pq.Array so it can be used as a
+// record field. Elements other than string, int64, float64, bool and []byte must
+// implement sql.Scanner and driver.Valuer, for example uuid.UUID.
+type Array[E any] []E
+
+// Value encodes the array.
+func (a Array[E]) Value() (driver.Value, error) {
+	return pq.Array([]E(a)).Value()
+}
+
+// Scan decodes an array column.
+func (a *Array[E]) Scan(src any) error {
+	return pq.Array((*[]E)(a)).Scan(src)
+}
+
+// ArrayField returns a field for an array column. The value is wrapped with
+// pq.Array so it is passed as a single positional argument. Use Array for the
+// record field so it can be scanned on reads.
+func ArrayField[T, E any](name string, getter func(*T) []E) *Field[T] {
+	return &Field[T]{
+		Name:   name,
+		Select: true,
+		Insert: Value,
+		Update: Value,
+		Value: func(record *T) (driver.Value, error) {
+			return pq.Array(getter(record)).Value()
+		},
+	}
+}
+
+// TimeField returns a field for a timestamp column stored in a time.Time record
+// field. The value is converted to UTC before it is bound and after it is read, so it
+// round trips the same way whatever the session time zone is. If the getter returns
+// nil, for example when the time is in an unset embedded struct, NULL is bound and
+// nothing is converted after the read.
+func TimeField[T any](name string, getter func(*T) *time.Time) *Field[T] {
+	return &Field[T]{
+		Name:   name,
+		Select: true,
+		Insert: Value,
+		Update: Value,
+		Value: func(record *T) (driver.Value, error) {
+			t := getter(record)
+			if t == nil {
+				return nil, nil
+			}
+			return t.UTC(), nil
+		},
+		Scan: func(record *T) error {
+			if t := getter(record); t != nil {
+				*t = t.UTC()
+			}
+			return nil
+		},
+	}
+}
+
+// PtrField returns a field for a nullable column stored in a *V record field, instead
+// of a sql.Null type. A nil pointer is bound as NULL and the value otherwise, and a
+// NULL column is scanned as nil.
+func PtrField[T, V any](name string, getter func(*T) *V) *Field[T] {
+	return &Field[T]{
+		Name:   name,
+		Select: true,
+		Insert: Value,
+		Update: Value,
+		Value: func(record *T) (driver.Value, error) {
+			v := getter(record)
+			if v == nil {
+				return nil, nil
+			}
+			return driver.DefaultParameterConverter.ConvertValue(*v)
+		},
+	}
+}
+
+// EncryptedField returns a field for a bytea column holding a string record field
+// encrypted with AES-GCM, so the value is only stored encrypted. The key must be 16,
+// 24 or 32 bytes. Each value is encrypted with a random nonce prepended to the
+// ciphertext, and the column name is authenticated so values cannot be moved between
+// columns. The record field is scanned with the ciphertext and decrypted in place
+// after every read, so Returning must include the field if it is set. An empty
+// string is stored as NULL.
+func EncryptedField[T any](name string, getter func(*T) string, setter func(*T, string), key []byte) *Field[T] {
+	var aead cipher.AEAD
+	block, keyErr := aes.NewCipher(key)
+	if keyErr == nil {
+		aead, keyErr = cipher.NewGCM(block)
+	}
+	if keyErr != nil {
+		keyErr = fmt.Errorf("invalid encryption key for field %s: %w", name, keyErr)
+	}
+	return &Field[T]{
+		err:    keyErr,
+		Name:   name,
+		Select: true,
+		Insert: Value,
+		Update: Value,
+		Value: func(record *T) (driver.Value, error) {
+			if keyErr != nil {
+				return nil, keyErr
+			}
+			plaintext := getter(record)
+			if plaintext == "" {
+				return nil, nil
+			}
+			nonce := make([]byte, aead.NonceSize())
+			if _, err := rand.Read(nonce); err != nil {
+				return nil, fmt.Errorf("could not generate nonce: %w", err)
+			}
+			return aead.Seal(nonce, nonce, []byte(plaintext), []byte(name)), nil
+		},
+		Scan: func(record *T) error {
+			if keyErr != nil {
+				return keyErr
+			}
+			ciphertext := getter(record)
+			if ciphertext == "" {
+				return nil
+			}
+			if len(ciphertext) < aead.NonceSize() {
+				return fmt.Errorf("encrypted value is too short")
+			}
+			nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+			plaintext, err := aead.Open(nil, []byte(nonce), []byte(sealed), []byte(name))
+			if err != nil {
+				return fmt.Errorf("could not decrypt value: %w", err)
+			}
+			setter(record, string(plaintext))
+			return nil
+		},
+	}
+}
+
+// timesToUTC converts every time.Time and *time.Time field of the struct v, including
+// nested structs, to UTC.
+func timesToUTC(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		}
+		switch {
+		case field.Type() == timeType:
+			field.Set(reflect.ValueOf(field.Interface().(time.Time).UTC()))
+		case field.Kind() == reflect.Struct && !isScalar(field.Type()):
+			timesToUTC(field)
+		}
+	}
+}
+
+// FieldsFromStruct returns the fields for T from its struct fields, named by the `db`
+// tag or the lower case field name like sqlx. Fields tagged `db:"-"` and nested
+// structs are skipped, embedded structs are flattened. A `pk:"true"` tag marks an ID
+// field which is inserted but not updated. A `readonly:"true"` tag marks a field
+// that is only selected, for example a column with a database default. Values are
+// read by reflection.
+func FieldsFromStruct[T any]() []*Field[T] {
+	var fields []*Field[T]
+	appendStructFields(reflect.TypeOf((*T)(nil)).Elem(), nil, &fields)
+	return fields
+}
+
+func appendStructFields[T any](t reflect.Type, index []int, fields *[]*Field[T]) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("db"), ",")
+		if name == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int{}, index...), i)
+
+		fieldType := sf.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if !isScalar(fieldType) {
+			if sf.Anonymous && name == "" {
+				appendStructFields(fieldType, fieldIndex, fields)
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+
+		field := &Field[T]{
+			Name:   name,
+			ID:     sf.Tag.Get("pk") == "true",
+			Select: true,
+		}
+		if sf.Tag.Get("readonly") != "true" {
+			field.Insert = Value
+			if !field.ID {
+				field.Update = Value
+			}
+		}
+		if field.ID || field.Insert != "" {
+			field.Value = func(record *T) (driver.Value, error) {
+				v, ok := fieldByIndex(reflect.ValueOf(record).Elem(), fieldIndex)
+				if !ok {
+					return nil, nil
+				}
+				return v.Interface(), nil
+			}
+		}
+		*fields = append(*fields, field)
+	}
+}
+
+// fieldByIndex returns the nested field. It returns false if an embedded pointer
+// along the way is nil.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
@@ -0,0 +1,113 @@
+package postgres_test
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/evertonbiviatello/go-commons/store/driver/postgres"
+)
+
+type settings struct {
+	Theme string   `json:"theme"`
+	Tags  []string `json:"tags"`
+}
+
+type profile struct {
+	ID          int64           `db:"id"`
+	SettingsRaw json.RawMessage `db:"settings"`
+	Settings    settings        `db:"-"`
+}
+
+func TestJSONField(t *testing.T) {
+	field := postgres.JSONField("settings",
+		func(r *profile) settings { return r.Settings },
+		func(r *profile, v settings) { r.Settings = v },
+	)
+	record := &profile{Settings: settings{Theme: "dark", Tags: []string{"a"}}}
+	value, err := field.Value(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"theme":"dark","tags":["a"]}`; value != want {
+		t.Errorf("Value = %v, want %s", value, want)
+	}
+
+	scanned := &profile{SettingsRaw: json.RawMessage(value.(string))}
+	if err := field.Scan(scanned); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(scanned.Settings, record.Settings) {
+		t.Errorf("Scan = %+v, want %+v", scanned.Settings, record.Settings)
+	}
+
+	// A NULL column decodes to the zero value.
+	scanned = &profile{Settings: settings{Theme: "stale"}}
+	if err := field.Scan(scanned); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(scanned.Settings, settings{}) {
+		t.Errorf("Scan of NULL = %+v, want the zero value", scanned.Settings)
+	}
+
+	// The record must have a field to scan the encoded value into.
+	missing := postgres.JSONField("options",
+		func(r *profile) settings { return r.Settings },
+		func(r *profile, v settings) { r.Settings = v },
+	)
+	if err := missing.Scan(&profile{}); err == nil {
+		t.Error("Scan without a raw field returned no error")
+	}
+}
+
+func TestTimeFieldNilGetter(t *testing.T) {
+	type audit struct {
+		At time.Time
+	}
+	type entry struct {
+		Audit *audit
+	}
+	field := postgres.TimeField("at", func(e *entry) *time.Time {
+		if e.Audit == nil {
+			return nil
+		}
+		return &e.Audit.At
+	})
+
+	value, err := field.Value(&entry{})
+	if err != nil || value != nil {
+		t.Errorf("Value of a nil time = %v, %v, want NULL", value, err)
+	}
+	if err := field.Scan(&entry{}); err != nil {
+		t.Errorf("Scan of a nil time: %v", err)
+	}
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	record := &entry{Audit: &audit{At: at}}
+	if err := field.Scan(record); err != nil || record.Audit.At.Location() != time.UTC || !record.Audit.At.Equal(at) {
+		t.Errorf("Scan = %v, %v, want %v in UTC", record.Audit.At, err, at)
+	}
+}
+
+func TestFieldConstructorErrorsAtInit(t *testing.T) {
+	fields := map[string]*postgres.Field[profile]{
+		"JSONField without a raw field": postgres.JSONField("options",
+			func(r *profile) settings { return r.Settings },
+			func(r *profile, v settings) { r.Settings = v },
+		),
+		"EncryptedField with a short key": postgres.EncryptedField("token",
+			func(r *profile) string { return string(r.SettingsRaw) },
+			func(r *profile, v string) { r.SettingsRaw = json.RawMessage(v) },
+			[]byte("short"),
+		),
+	}
+	for name, field := range fields {
+		id := &postgres.Field[profile]{Name: "id", ID: true, Select: true, Insert: postgres.Value, Value: func(r *profile) (driver.Value, error) { return r.ID, nil }}
+		table := &postgres.Table[profile]{Table: "profiles", Fields: []*postgres.Field[profile]{id, field}}
+		if err := table.Init(); err == nil {
+			t.Errorf("Init with %s returned no error", name)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package postgres
+
+import (
+	"context"
+)
+
+// Ping checks the database is reachable by running SELECT 1.
+func Ping(ctx context.Context, db DB) error {
+	var one int
+	if err := db.GetContext(ctx, &one, `SELECT 1`); err != nil {
+		return wrapQueryError(ctx, err)
+	}
+	return nil
+}
+
+// SchemaExists returns true if the schema exists in the database.
+func SchemaExists(ctx context.Context, db DB, schema string) (bool, error) {
+	var exists bool
+	if err := db.GetContext(ctx, &exists, `SELECT EXISTS(SELECT 1 FROM information_schema.schemata WHERE schema_name = $1)`, schema); err != nil {
+		return false, wrapQueryError(ctx, err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"strings"
+)
+
+// JoinType is the type of a Join.
+type JoinType string
+
+const (
+	JoinTypeInner JoinType = "INNER"
+	JoinTypeLeft  JoinType = "LEFT"
+)
+
+// Join is a table joined when fetching data from a table.
+type Join struct {
+	// Type of the join, defaults to INNER.
+	Type JoinType
+	// Table to join, including the schema if needed.
+	Table string
+	// Alias is an optional alias to reference the joined table by.
+	Alias string
+	// On is the join condition.
+	On string
+}
+
+// String returns the join SQL.
+func (j Join) String() string {
+	var b strings.Builder
+	if j.Type == "" {
+		b.WriteString(string(JoinTypeInner))
+	} else {
+		b.WriteString(string(j.Type))
+	}
+	b.WriteString(" JOIN ")
+	b.WriteString(j.Table)
+	if j.Alias != "" {
+		b.WriteString(" AS ")
+		b.WriteString(j.Alias)
+	}
+	b.WriteString(" ON ")
+	b.WriteString(j.On)
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ListenMinReconnect is the delay before Listen reconnects after the connection is
+	// lost. It doubles on every failed attempt.
+	ListenMinReconnect = 10 * time.Second
+	// ListenMaxReconnect is the maximum delay between Listen reconnection attempts.
+	ListenMaxReconnect = time.Minute
+	// ListenPingInterval is how often Listen checks its connection is still alive.
+	ListenPingInterval = 90 * time.Second
+)
+
+// Listen calls handler with the payload of every notification sent on channel with
+// NOTIFY until ctx is done, then returns the context error. It uses a dedicated
+// connection that is reconnected if it is lost. Notifications sent while the
+// connection is down are missed. The handler is called sequentially, a slow handler
+// delays the following notifications. Use ListenWithErrors to be told when the
+// connection is lost.
+func Listen(ctx context.Context, connString, channel string, handler func(payload string)) error {
+	return ListenWithErrors(ctx, connString, channel, handler, nil)
+}
+
+// ListenWithErrors listens like Listen and also calls onError, if it is not nil,
+// when the connection is lost or an attempt to reconnect fails, so the missed
+// notifications can be recovered once the handler is called again. It is called
+// sequentially with the handler.
+func ListenWithErrors(ctx context.Context, connString, channel string, handler func(payload string), onError func(err error)) error {
+
+	done := make(chan struct{})
+	defer close(done)
+	errs := make(chan error)
+	listener := pq.NewListener(connString, ListenMinReconnect, ListenMaxReconnect, listenerEvents(errs, done))
+	defer listener.Close()
+
+	if err := listener.Listen(channel); err != nil {
+		return fmt.Errorf("could not listen on channel %s: %w", channel, err)
+	}
+
+	ping := time.NewTicker(ListenPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n := <-listener.Notify:
+			// A nil notification is sent after the connection is re-established.
+			if n != nil {
+				handler(n.Extra)
+			}
+		case err := <-errs:
+			if onError != nil {
+				onError(err)
+			}
+		case <-ping.C:
+			// A failed ping causes the listener to reconnect.
+			go func() { _ = listener.Ping() }()
+		}
+	}
+
+}
+
+// listenerEvents returns a pq listener event callback sending the connection
+// failures to errs until done is closed.
+func listenerEvents(errs chan<- error, done <-chan struct{}) pq.EventCallbackType {
+	return func(event pq.ListenerEventType, err error) {
+		var msg string
+		switch event {
+		case pq.ListenerEventDisconnected:
+			msg = "listener disconnected"
+		case pq.ListenerEventConnectionAttemptFailed:
+			msg = "listener could not connect"
+		default:
+			return
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %w", msg, err)
+		} else {
+			err = errors.New(msg)
+		}
+		select {
+		case errs <- err:
+		case <-done:
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestListenerEventsSurfaceConnectionFailures(t *testing.T) {
+	errs := make(chan error, 3)
+	done := make(chan struct{})
+	callback := listenerEvents(errs, done)
+
+	callback(pq.ListenerEventConnected, nil)
+	callback(pq.ListenerEventDisconnected, io.EOF)
+	callback(pq.ListenerEventConnectionAttemptFailed, io.ErrUnexpectedEOF)
+	callback(pq.ListenerEventReconnected, nil)
+	close(errs)
+
+	var got []error
+	for err := range errs {
+		got = append(got, err)
+	}
+	if len(got) != 2 || !errors.Is(got[0], io.EOF) || !errors.Is(got[1], io.ErrUnexpectedEOF) {
+		t.Fatalf("errors = %v, want the disconnect and the failed attempt", got)
+	}
+
+	// Once listening stopped the callback does not block.
+	close(done)
+	listenerEvents(make(chan error), done)(pq.ListenerEventDisconnected, io.EOF)
+}
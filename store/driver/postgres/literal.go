@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Literal renders a value as a SQL literal, for example a Field NullVal used in a
+// COALESCE. Strings are quoted with any quotes escaped, numbers and booleans are
+// written as is, time.Time is written as a timestamptz and nil as NULL. A
+// driver.Valuer is rendered from its value. Any other type returns an error.
+func Literal(v any) (string, error) {
+
+	if valuer, ok := v.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			return "", fmt.Errorf("could not get literal value: %w", err)
+		}
+		v = value
+	}
+	if v == nil {
+		return "NULL", nil
+	}
+	if t, ok := v.(time.Time); ok {
+		return "'" + t.Format(time.RFC3339Nano) + "'::timestamptz", nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		s := rv.String()
+		if strings.ContainsRune(s, 0) {
+			return "", fmt.Errorf("string literal cannot contain a null byte")
+		}
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'", nil
+	case reflect.Bool:
+		if rv.Bool() {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "'" + strconv.FormatFloat(f, 'g', -1, 64) + "'::float8", nil
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported literal type %T", v)
+
+}
@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLiteral(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   any
+		want    string
+		wantErr bool
+	}{
+		{name: "nil", value: nil, want: "NULL"},
+		{name: "string", value: "active", want: "'active'"},
+		{name: "quoted string", value: "O'Brien", want: "'O''Brien'"},
+		{name: "empty string", value: "", want: "''"},
+		{name: "null byte", value: "a\x00b", wantErr: true},
+		{name: "int", value: 42, want: "42"},
+		{name: "negative int64", value: int64(-7), want: "-7"},
+		{name: "uint8", value: uint8(255), want: "255"},
+		{name: "true", value: true, want: "TRUE"},
+		{name: "false", value: false, want: "FALSE"},
+		{name: "float", value: 1.5, want: "1.5"},
+		{name: "NaN", value: math.NaN(), want: "'NaN'::float8"},
+		{name: "+Inf", value: math.Inf(1), want: "'+Inf'::float8"},
+		{name: "-Inf", value: math.Inf(-1), want: "'-Inf'::float8"},
+		{name: "time", value: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), want: "'2024-01-02T03:04:05Z'::timestamptz"},
+		{name: "valuer", value: sql.NullString{String: "x", Valid: true}, want: "'x'"},
+		{name: "null valuer", value: sql.NullInt64{}, want: "NULL"},
+		{name: "struct", value: struct{ A int }{A: 1}, wantErr: true},
+		{name: "slice", value: []int{1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Literal(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Literal(%#v) = %q, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Literal(%#v) error: %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("Literal(%#v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
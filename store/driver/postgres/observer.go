@@ -0,0 +1,24 @@
+package postgres
+
+import (
+	"time"
+)
+
+// Observer is called at the end of each Table operation with the operation name,
+// the schema qualified table name, the duration, the number of rows read or written
+// and the error if any. It is not called when unset.
+var Observer func(op string, table string, dur time.Duration, rows int64, err error)
+
+// observe reports an operation to Observer. It is deferred with pointers to the row
+// count and error so the final values are reported.
+func (t *Table[T]) observe(op string, start time.Time, rows *int64, err *error) {
+	Observer(op, t.qualifiedName(), time.Since(start), *rows, *err)
+}
+
+// qualifiedName returns the table name including the schema if it is set.
+func (t *Table[T]) qualifiedName() string {
+	if t.Schema == "" {
+		return t.Table
+	}
+	return t.Schema + "." + t.Table
+}
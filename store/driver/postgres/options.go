@@ -1,10 +1,121 @@
 package postgres
 
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
 type QueryOptions struct {
 	// Ignore return will cause the query to ignore the return value from a
 	// Insert, Upsert or Update query. Normally these queries will return/update
 	// in place the new value it is returning.
 	IgnoreReturn bool
+	// Returning limits the fields returned from a Insert, Upsert or Update
+	// query to the named fields. Only those fields are updated in the record.
+	// The query is generated from the table fields for that call.
+	Returning []string
+	// ConflictColumns sets the conflict target of an Upsert query. It defaults
+	// to the ID fields.
+	ConflictColumns []string
+	// ConflictUpdate limits the fields set by an Upsert query on conflict to
+	// the named fields. Fields without an Update value are set from the
+	// excluded row.
+	ConflictUpdate []string
+	// ConflictWhere is the index predicate of the conflict target of an Upsert
+	// query, written after the ConflictColumns. It is required to upsert into a
+	// partial unique index, for example "deleted_at IS NULL".
+	ConflictWhere string
+	// ConflictDoNothing skips conflicting rows in an Upsert query instead of
+	// updating them. Skipped rows are not returned.
+	ConflictDoNothing bool
+	// Timeout limits the duration of the call, including any extra queries it
+	// runs. Zero means no timeout beyond the context.
+	Timeout time.Duration
+	// RequireRows causes UpdateN and UpsertN, and Update and Upsert with
+	// IgnoreReturn, to return store.ErrNotFound when no rows were affected.
+	RequireRows bool
+	// Result is set to the sql.Result of an Insert, Upsert or Update query
+	// when IgnoreReturn is set, for example to check RowsAffected. For InsertBatch
+	// and UpsertBatch it holds the rows affected by all the statements.
+	Result *sql.Result
+	// Lock locks the rows read by GetByIDWithOpts or GetByQueryWithOpts until the
+	// end of the transaction. It is only meaningful inside a transaction.
+	Lock LockMode
+	// FieldValues replaces the value of the named fields in an Insert, Upsert or
+	// Update query without calling their Value function or changing the record.
+	FieldValues map[string]driver.Value
+	// PlannerSettings are set with SET LOCAL before the query runs, for example
+	// to disable a plan type on a hot path. They last until the end of the
+	// transaction, so they are only meaningful inside one.
+	PlannerSettings []PlannerSetting
+	// IntoNew is a **T set to a new record scanned from the row returned by an
+	// Insert, Upsert or Update query, leaving the record passed in unchanged. It is
+	// not set when IgnoreReturn is set.
+	IntoNew any
+	// SkipPostProcess skips the PostProcessRecord of the table for the records read
+	// or returned, for example when they are enriched in bulk later. The field Scan
+	// functions are still called.
+	SkipPostProcess bool
+}
+
+// PlannerSetting is a configuration parameter set for the rest of a transaction.
+type PlannerSetting struct {
+	Key   string
+	Value string
+}
+
+// LockMode is the row locking clause of a select.
+type LockMode string
+
+const (
+	LockNone                LockMode = ""
+	LockForUpdate           LockMode = "FOR UPDATE"
+	LockForUpdateNoWait     LockMode = "FOR UPDATE NOWAIT"
+	LockForUpdateSkipLocked LockMode = "FOR UPDATE SKIP LOCKED"
+	LockForShare            LockMode = "FOR SHARE"
+)
+
+// clause returns the locking clause, only locking the rows of table if it is set.
+func (m LockMode) clause(table string) string {
+	if m == LockNone || table == "" {
+		return string(m)
+	}
+	strength, wait := string(m), ""
+	for _, suffix := range []string{" NOWAIT", " SKIP LOCKED"} {
+		if strings.HasSuffix(strength, suffix) {
+			strength, wait = strings.TrimSuffix(strength, suffix), suffix
+		}
+	}
+	return strength + " OF " + table + wait
+}
+
+// hasConflict returns true if any of the upsert conflict options are set.
+func (o QueryOptions) hasConflict() bool {
+	return len(o.ConflictColumns) > 0 || len(o.ConflictUpdate) > 0 || o.ConflictWhere != "" || o.ConflictDoNothing
+}
+
+// applySettings sets the PlannerSettings for the rest of the transaction of db. It
+// uses set_config which is the same as SET LOCAL but takes the key and value as
+// arguments.
+func (o QueryOptions) applySettings(ctx context.Context, db DB) error {
+	for _, setting := range o.PlannerSettings {
+		if _, err := db.ExecContext(ctx, `SELECT set_config($1, $2, true)`, setting.Key, setting.Value); err != nil {
+			return fmt.Errorf("could not set %s: %w", setting.Key, wrapQueryError(ctx, err))
+		}
+	}
+	return nil
+}
+
+// context returns the context for a call with the Timeout applied.
+func (o QueryOptions) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.Timeout > 0 {
+		return context.WithTimeout(ctx, o.Timeout)
+	}
+	return ctx, func() {}
 }
 
 type QueryOption func(opt *QueryOptions) error
@@ -19,3 +130,110 @@ func QueryOptionIgnoreReturn(v bool) QueryOption {
 		return nil
 	}
 }
+
+func QueryOptionReturning(fields ...string) QueryOption {
+	return func(opt *QueryOptions) error {
+		opt.Returning = fields
+		return nil
+	}
+}
+
+func QueryOptionConflictColumns(columns ...string) QueryOption {
+	return func(opt *QueryOptions) error {
+		opt.ConflictColumns = columns
+		return nil
+	}
+}
+
+func QueryOptionConflictUpdate(fields ...string) QueryOption {
+	return func(opt *QueryOptions) error {
+		opt.ConflictUpdate = fields
+		return nil
+	}
+}
+
+func QueryOptionConflictWhere(predicate string) QueryOption {
+	return func(opt *QueryOptions) error {
+		opt.ConflictWhere = predicate
+		return nil
+	}
+}
+
+func QueryOptionConflictDoNothing(v bool) QueryOption {
+	return func(opt *QueryOptions) error {
+		opt.ConflictDoNothing = v
+		return nil
+	}
+}
+
+func QueryOptionTimeout(d time.Duration) QueryOption {
+	return func(opt *QueryOptions) error {
+		if d < 0 {
+			return fmt.Errorf("invalid timeout %s", d)
+		}
+		opt.Timeout = d
+		return nil
+	}
+}
+
+func QueryOptionRequireRows(v bool) QueryOption {
+	return func(opt *QueryOptions) error {
+		opt.RequireRows = v
+		return nil
+	}
+}
+
+func QueryOptionResult(result *sql.Result) QueryOption {
+	return func(opt *QueryOptions) error {
+		opt.Result = result
+		return nil
+	}
+}
+
+func QueryOptionLock(mode LockMode) QueryOption {
+	return func(opt *QueryOptions) error {
+		switch mode {
+		case LockNone, LockForUpdate, LockForUpdateNoWait, LockForUpdateSkipLocked, LockForShare:
+		default:
+			return fmt.Errorf("unknown lock mode %s", mode)
+		}
+		opt.Lock = mode
+		return nil
+	}
+}
+
+func QueryOptionFieldValue(name string, v driver.Value) QueryOption {
+	return func(opt *QueryOptions) error {
+		values := make(map[string]driver.Value, len(opt.FieldValues)+1)
+		for n, value := range opt.FieldValues {
+			values[n] = value
+		}
+		values[name] = v
+		opt.FieldValues = values
+		return nil
+	}
+}
+
+func QueryOptionPlannerSetting(key, value string) QueryOption {
+	return func(opt *QueryOptions) error {
+		if key == "" {
+			return fmt.Errorf("planner setting requires a key")
+		}
+		opt.PlannerSettings = append(opt.PlannerSettings, PlannerSetting{Key: key, Value: value})
+		return nil
+	}
+}
+
+func QueryOptionIntoNew(dest any) QueryOption {
+	return func(opt *QueryOptions) error {
+		opt.IntoNew = dest
+		return nil
+	}
+}
+
+func QueryOptionSkipPostProcess(v bool) QueryOption {
+	return func(opt *QueryOptions) error {
+		opt.SkipPostProcess = v
+		return nil
+	}
+}
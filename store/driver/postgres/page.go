@@ -0,0 +1,289 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/evertonbiviatello/go-commons/store"
+)
+
+// ErrInvalidCursor is returned when a Cursor cannot be decoded for the requested sort.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is an opaque position in a result set returned by SelectPage. An empty
+// Cursor starts from the beginning.
+type Cursor string
+
+// pageKey is a single sort key used for keyset pagination.
+type pageKey[T any] struct {
+	field  *Field[T]
+	column string
+	desc   bool
+}
+
+// SelectPage fetches up to limit records after the cursor using keyset pagination.
+// Records are sorted by the order provided followed by any ID fields not already
+// included, so the sort is always unique. If no order is provided, the ID fields are
+// used. Every sort field must have a Value function so the cursor can be built from
+// the last record. The returned Cursor is empty when there are no more records.
+func (t *Table[T]) SelectPage(ctx context.Context, db DB, after Cursor, limit int, order ...OrderBy) ([]*T, Cursor, error) {
+	return t.SelectPageWithOpts(ctx, db, after, limit, order)
+}
+
+// SelectPageWithOpts fetches up to limit records after the cursor like SelectPage
+// with query options.
+func (t *Table[T]) SelectPageWithOpts(ctx context.Context, db DB, after Cursor, limit int, order []OrderBy, opts ...QueryOption) (_ []*T, _ Cursor, err error) {
+
+	var rows int64
+	if Observer != nil {
+		defer t.observe("SelectPage", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "SelectPage")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+
+	keys, err := t.pageKeys(order)
+	if err != nil {
+		return nil, "", &store.Error{Type: store.ErrorTypeQuery, Err: err}
+	}
+	if SlogLogger != nil {
+		// The cursor binds the value of each sort key.
+		names := make([]string, len(keys))
+		for i, key := range keys {
+			names[i] = key.field.Name
+		}
+		db = t.logged(db, "SelectPage", names)
+	}
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return nil, "", fmt.Errorf("query option error: %w", err)
+		}
+	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return nil, "", err
+	}
+	s := t.selector(queryOptions)
+
+	var query strings.Builder
+	var queryParams []any
+
+	query.WriteString(s.Query)
+
+	var conditions []string
+	if s.Where != "" {
+		conditions = append(conditions, s.Where)
+	}
+	if after != "" {
+		values, err := decodeCursor(after)
+		if err != nil || len(values) != len(keys) {
+			return nil, "", &store.Error{Type: store.ErrorTypeQuery, Err: ErrInvalidCursor}
+		}
+		queryParams = values
+		conditions = append(conditions, keysetPredicate(keys))
+	}
+	if len(conditions) > 0 {
+		query.WriteString(" WHERE ")
+		query.WriteString(strings.Join(conditions, " AND "))
+	}
+
+	query.WriteString(" ORDER BY ")
+	for i, key := range keys {
+		if i > 0 {
+			query.WriteString(",")
+		}
+		query.WriteString(key.column)
+		if key.desc {
+			query.WriteString(" DESC")
+		} else {
+			query.WriteString(" ASC")
+		}
+	}
+	if limit > 0 {
+		query.WriteString(" LIMIT " + strconv.Itoa(limit))
+	}
+
+	span.SetAttribute("db.statement", query.String())
+	var records = make([]*T, 0)
+	if err := db.SelectContext(ctx, &records, query.String(), queryParams...); err != nil {
+		return nil, "", wrapQueryError(ctx, err)
+	}
+	if postProcessRecord := postProcessRecordFunc(s.PostProcessRecordCtx, s.PostProcessRecord); postProcessRecord != nil {
+		for _, record := range records {
+			if err := postProcessRecord(ctx, record); err != nil {
+				return nil, "", fmt.Errorf("post process record error: %w", err)
+			}
+		}
+	}
+
+	// If we got a full page, there may be more records.
+	var next Cursor
+	if limit > 0 && len(records) == limit {
+		next, err = encodeCursor(records[len(records)-1], keys)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	rows = int64(len(records))
+	return records, next, nil
+
+}
+
+// pageKeys resolves the sort keys for the order with the ID fields appended.
+func (t *Table[T]) pageKeys(order []OrderBy) ([]pageKey[T], error) {
+
+	fields := make(map[string]*Field[T], len(t.Fields))
+	for _, field := range t.Fields {
+		fields[strings.Trim(field.Name, `"`)] = field
+	}
+
+	var keys []pageKey[T]
+	used := make(map[*Field[T]]bool)
+	for _, orderBy := range order {
+		field, ok := fields[orderBy.Field]
+		if !ok {
+			return nil, fmt.Errorf("unknown sort field %s", orderBy.Field)
+		}
+		if field.Value == nil {
+			return nil, fmt.Errorf("sort field %s has no Value function", orderBy.Field)
+		}
+		if orderBy.Nulls != NullsDefault {
+			return nil, fmt.Errorf("sort field %s cannot set nulls order, keyset pagination does not support null values", orderBy.Field)
+		}
+		keys = append(keys, pageKey[T]{field: field, column: t.ref() + "." + field.Name, desc: orderBy.Desc})
+		used[field] = true
+	}
+
+	// ID fields follow the direction of the last sort field.
+	var desc bool
+	if len(keys) > 0 {
+		desc = keys[len(keys)-1].desc
+	}
+	for _, field := range t.Fields {
+		if field.ID && !used[field] {
+			if field.Value == nil {
+				return nil, fmt.Errorf("ID field %s has no Value function", field.Name)
+			}
+			keys = append(keys, pageKey[T]{field: field, column: t.ref() + "." + field.Name, desc: desc})
+		}
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoIDFields
+	}
+	return keys, nil
+
+}
+
+// keysetPredicate returns the condition selecting records after the cursor
+// values bound to $1..$n. If all keys sort the same direction it uses a row
+// comparison, otherwise each key is compared in turn.
+func keysetPredicate[T any](keys []pageKey[T]) string {
+
+	sameDirection := true
+	for _, key := range keys {
+		if key.desc != keys[0].desc {
+			sameDirection = false
+			break
+		}
+	}
+
+	var b strings.Builder
+	if sameDirection {
+		b.WriteString("(")
+		for i, key := range keys {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(key.column)
+		}
+		if keys[0].desc {
+			b.WriteString(") < (")
+		} else {
+			b.WriteString(") > (")
+		}
+		for i := range keys {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString("$" + strconv.Itoa(i+1))
+		}
+		b.WriteString(")")
+		return b.String()
+	}
+
+	// (a > $1) OR (a = $1 AND b < $2) OR ...
+	b.WriteString("(")
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteString(" OR ")
+		}
+		b.WriteString("(")
+		for j := 0; j < i; j++ {
+			b.WriteString(keys[j].column + " = $" + strconv.Itoa(j+1) + " AND ")
+		}
+		b.WriteString(key.column)
+		if key.desc {
+			b.WriteString(" < $")
+		} else {
+			b.WriteString(" > $")
+		}
+		b.WriteString(strconv.Itoa(i + 1))
+		b.WriteString(")")
+	}
+	b.WriteString(")")
+	return b.String()
+
+}
+
+// encodeCursor builds a cursor from the sort key values of record.
+func encodeCursor[T any](record *T, keys []pageKey[T]) (Cursor, error) {
+	values := make([]any, 0, len(keys))
+	for _, key := range keys {
+		value, err := key.field.Value(record)
+		if err != nil {
+			return "", fmt.Errorf("could not get cursor value for field %s: %w", key.field.Name, err)
+		}
+		values = append(values, value)
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("could not encode cursor: %w", err)
+	}
+	return Cursor(base64.RawURLEncoding.EncodeToString(b)), nil
+}
+
+// decodeCursor returns the sort key values stored in a cursor.
+func decodeCursor(c Cursor) ([]any, error) {
+	b, err := base64.RawURLEncoding.DecodeString(string(c))
+	if err != nil {
+		return nil, err
+	}
+	var values []any
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		// Keep integers exact. Anything else is passed as text for postgres to parse.
+		if n, ok := value.(json.Number); ok {
+			if v, err := n.Int64(); err == nil {
+				values[i] = v
+			} else {
+				values[i] = n.String()
+			}
+		}
+	}
+	return values, nil
+}
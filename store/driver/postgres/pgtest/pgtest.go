@@ -0,0 +1,104 @@
+// Package pgtest provides helpers for testing code using the postgres driver
+// without a database.
+package pgtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+
+	"github.com/evertonbiviatello/go-commons/store/driver/postgres"
+)
+
+// Method is the DB method of a recorded call.
+type Method string
+
+const (
+	MethodGet    Method = "GetContext"
+	MethodSelect Method = "SelectContext"
+	MethodExec   Method = "ExecContext"
+)
+
+// Call is a single recorded DB call.
+type Call struct {
+	Method Method
+	Query  string
+	Args   []interface{}
+}
+
+// RecordingDB is a DB that records every call so tests can assert the generated
+// SQL and arguments. By default calls succeed without touching dest and ExecContext
+// reports no rows affected. Set the Func fields to return results or errors.
+type RecordingDB struct {
+	// GetFunc is called by GetContext after the call is recorded.
+	GetFunc func(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	// SelectFunc is called by SelectContext after the call is recorded.
+	SelectFunc func(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	// ExecFunc is called by ExecContext after the call is recorded.
+	ExecFunc func(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ postgres.DB = (*RecordingDB)(nil)
+
+// NewRecordingDB returns an empty RecordingDB.
+func NewRecordingDB() *RecordingDB {
+	return &RecordingDB{}
+}
+
+func (db *RecordingDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	db.record(MethodGet, query, args)
+	if db.GetFunc != nil {
+		return db.GetFunc(ctx, dest, query, args...)
+	}
+	return nil
+}
+
+func (db *RecordingDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	db.record(MethodSelect, query, args)
+	if db.SelectFunc != nil {
+		return db.SelectFunc(ctx, dest, query, args...)
+	}
+	return nil
+}
+
+func (db *RecordingDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	db.record(MethodExec, query, args)
+	if db.ExecFunc != nil {
+		return db.ExecFunc(ctx, query, args...)
+	}
+	return driver.RowsAffected(0), nil
+}
+
+// Calls returns a copy of the recorded calls in order.
+func (db *RecordingDB) Calls() []Call {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]Call(nil), db.calls...)
+}
+
+// LastCall returns the most recent call. It returns false if there were no calls.
+func (db *RecordingDB) LastCall() (Call, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if len(db.calls) == 0 {
+		return Call{}, false
+	}
+	return db.calls[len(db.calls)-1], true
+}
+
+// Reset clears the recorded calls.
+func (db *RecordingDB) Reset() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.calls = nil
+}
+
+func (db *RecordingDB) record(method Method, query string, args []interface{}) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.calls = append(db.calls, Call{Method: method, Query: query, Args: append([]interface{}(nil), args...)})
+}
@@ -0,0 +1,223 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PgxQuerier is the query interface implemented by *pgxpool.Pool, *pgx.Conn and pgx.Tx.
+type PgxQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// PgxDB implements DB on top of pgx so tables can be used without sqlx. Columns are
+// mapped to struct fields the same way sqlx does, using the `db` tag or the lower
+// case field name.
+type PgxDB struct {
+	q PgxQuerier
+}
+
+var _ DB = (*PgxDB)(nil)
+
+// NewPgxDB returns a DB using the pgx pool, connection or transaction.
+func NewPgxDB(q PgxQuerier) *PgxDB {
+	return &PgxDB{q: q}
+}
+
+// InTransaction returns true if the querier is a pgx.Tx.
+func (db *PgxDB) InTransaction() bool {
+	_, ok := db.q.(pgx.Tx)
+	return ok
+}
+
+// GetContext scans a single row into dest. It returns sql.ErrNoRows if there are no rows.
+func (db *PgxDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return fmt.Errorf("destination must be a non-nil pointer, got %T", dest)
+	}
+
+	rows, err := db.q.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	if err := scanRow(rows, value); err != nil {
+		return err
+	}
+	rows.Close()
+	return rows.Err()
+
+}
+
+// SelectContext scans all rows into dest which must be a pointer to a slice.
+func (db *PgxDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("destination must be a pointer to a slice, got %T", dest)
+	}
+	slice := value.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+
+	rows, err := db.q.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		elem := reflect.New(elemType)
+		if err := scanRow(rows, elem); err != nil {
+			return err
+		}
+		if isPtr {
+			slice = reflect.Append(slice, elem)
+		} else {
+			slice = reflect.Append(slice, elem.Elem())
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	value.Elem().Set(slice)
+	return nil
+
+}
+
+// ExecContext executes a query without returning rows.
+func (db *PgxDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	tag, err := db.q.Exec(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgxResult(tag), nil
+}
+
+// pgxResult implements sql.Result from a pgx command tag.
+type pgxResult pgconn.CommandTag
+
+func (r pgxResult) LastInsertId() (int64, error) {
+	return 0, errors.New("LastInsertId is not supported by postgres, use RETURNING")
+}
+
+func (r pgxResult) RowsAffected() (int64, error) {
+	return pgconn.CommandTag(r).RowsAffected(), nil
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// scanRow scans the current row into dest, a pointer. Structs are scanned by
+// column name, anything else is scanned directly.
+func scanRow(rows pgx.Rows, dest reflect.Value) error {
+
+	elem := dest.Elem()
+	if isScalar(elem.Type()) {
+		return rows.Scan(dest.Interface())
+	}
+
+	fields := structFieldMap(elem.Type())
+	targets := make([]any, len(rows.FieldDescriptions()))
+	for i, fd := range rows.FieldDescriptions() {
+		index, ok := fields[fd.Name]
+		if !ok {
+			return fmt.Errorf("missing destination name %s in %s", fd.Name, elem.Type())
+		}
+		targets[i] = fieldByIndexAlloc(elem, index).Addr().Interface()
+	}
+	return rows.Scan(targets...)
+
+}
+
+// isScalar returns true if t should be scanned as a single value rather than by column.
+func isScalar(t reflect.Type) bool {
+	return t.Kind() != reflect.Struct || t == timeType || reflect.PointerTo(t).Implements(scannerType)
+}
+
+var structFieldMaps sync.Map // map[reflect.Type]map[string][]int
+
+// structFieldMap maps column names to struct field indexes. Nested structs are
+// mapped with their name as a prefix separated by a dot, embedded structs are
+// flattened.
+func structFieldMap(t reflect.Type) map[string][]int {
+	if m, ok := structFieldMaps.Load(t); ok {
+		return m.(map[string][]int)
+	}
+	m := make(map[string][]int)
+	buildStructFieldMap(t, "", nil, m)
+	structFieldMaps.Store(t, m)
+	return m
+}
+
+func buildStructFieldMap(t reflect.Type, prefix string, index []int, m map[string][]int) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("db"), ",")
+		if name == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int{}, index...), i)
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		nested := !isScalar(fieldType)
+
+		if field.Anonymous && name == "" && nested {
+			buildStructFieldMap(fieldType, prefix, fieldIndex, m)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if _, exists := m[prefix+name]; !exists {
+			m[prefix+name] = fieldIndex
+		}
+		if nested {
+			buildStructFieldMap(fieldType, prefix+name+".", fieldIndex, m)
+		}
+	}
+}
+
+// fieldByIndexAlloc returns the nested field allocating any nil pointers along the way.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/evertonbiviatello/go-commons/store"
+)
+
+// QueryBuilder composes a select over a Table. Filters and sorts reference the
+// declared Fields by name like Select, so columns are validated when the query is
+// built. The first invalid call is reported by Build or Select.
+type QueryBuilder[T any] struct {
+	table *Table[T]
+	qp    QueryParams
+	err   error
+}
+
+// Query returns a QueryBuilder selecting the records of the table.
+func (t *Table[T]) Query() *QueryBuilder[T] {
+	return &QueryBuilder[T]{table: t}
+}
+
+// Where adds a filter comparing the field to value. Filters are combined with AND.
+func (q *QueryBuilder[T]) Where(field string, op FilterOp, value any) *QueryBuilder[T] {
+	q.qp.Filter = append(q.qp.Filter, Filter{Field: field, Op: op, Value: value})
+	return q
+}
+
+// WhereIn adds a filter matching the field to any of the elements of the slice values.
+func (q *QueryBuilder[T]) WhereIn(field string, values any) *QueryBuilder[T] {
+	return q.Where(field, FilterOpIn, values)
+}
+
+// WhereNotIn adds a filter matching the field to none of the elements of the slice values.
+func (q *QueryBuilder[T]) WhereNotIn(field string, values any) *QueryBuilder[T] {
+	return q.Where(field, FilterOpNotIn, values)
+}
+
+// OrderBy adds sorts by fields. The ID fields are always sorted last.
+func (q *QueryBuilder[T]) OrderBy(orderBy ...OrderBy) *QueryBuilder[T] {
+	q.qp.Sort = append(q.qp.Sort, orderBy...)
+	return q
+}
+
+// DistinctOn keeps only the first record of each set of records with equal values
+// of the fields, in the sort order. The sort is made to start with the fields.
+func (q *QueryBuilder[T]) DistinctOn(fields ...string) *QueryBuilder[T] {
+	q.qp.DistinctOn = append(q.qp.DistinctOn, fields...)
+	return q
+}
+
+// Limit limits the number of records returned, zero means no limit.
+func (q *QueryBuilder[T]) Limit(limit int64) *QueryBuilder[T] {
+	if limit < 0 && q.err == nil {
+		q.err = fmt.Errorf("invalid limit %d", limit)
+	}
+	q.qp.Limit = limit
+	return q
+}
+
+// Offset skips the first records.
+func (q *QueryBuilder[T]) Offset(offset int64) *QueryBuilder[T] {
+	if offset < 0 && q.err == nil {
+		q.err = fmt.Errorf("invalid offset %d", offset)
+	}
+	q.qp.Offset = offset
+	return q
+}
+
+// Build returns the query and arguments with dollar placeholders.
+func (q *QueryBuilder[T]) Build() (string, []any, error) {
+	if q.err != nil {
+		return "", nil, &store.Error{Type: store.ErrorTypeQuery, Err: q.err}
+	}
+	s := q.table.selector(DefaultQueryOptions)
+	return s.Build(q.qp)
+}
+
+// Select runs the query and returns the records. It returns an empty slice if
+// there are no matches.
+func (q *QueryBuilder[T]) Select(ctx context.Context, db DB) ([]*T, error) {
+	if q.err != nil {
+		return nil, &store.Error{Type: store.ErrorTypeQuery, Err: q.err}
+	}
+	return q.table.Select(ctx, db, q.qp)
+}
@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// rowsConnector is a database/sql connector whose queries all return the rows.
+type rowsConnector struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (c *rowsConnector) Connect(context.Context) (driver.Conn, error) { return &rowsConn{c: c}, nil }
+func (c *rowsConnector) Driver() driver.Driver                        { return nil }
+
+type rowsConn struct{ c *rowsConnector }
+
+func (conn *rowsConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (conn *rowsConn) Close() error                        { return nil }
+func (conn *rowsConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (conn *rowsConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{columns: conn.c.columns, rows: conn.c.rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// observed records the calls to Observer until the test ends.
+type observed struct {
+	op   string
+	rows int64
+	err  error
+}
+
+func observeCalls(t *testing.T) *[]observed {
+	t.Helper()
+	var calls []observed
+	Observer = func(op string, _ string, _ time.Duration, rows int64, err error) {
+		calls = append(calls, observed{op: op, rows: rows, err: err})
+	}
+	t.Cleanup(func() { Observer = nil })
+	return &calls
+}
+
+// captureLogs sets SlogLogger to log at debug level to the returned builder until
+// the test ends.
+func captureLogs(t *testing.T) *strings.Builder {
+	t.Helper()
+	var logs strings.Builder
+	SlogLogger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	t.Cleanup(func() { SlogLogger = nil })
+	return &logs
+}
+
+func newQueryerDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	connector := &rowsConnector{columns: []string{"id", "total", "note"}, rows: [][]driver.Value{{int64(1), int64(10), "a"}, {int64(2), int64(20), "b"}}}
+	db := sqlx.NewDb(sql.OpenDB(connector), "postgres")
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestIterateInstrumented(t *testing.T) {
+	calls := observeCalls(t)
+	logs := captureLogs(t)
+	table := &Table[order]{Table: "orders", Fields: FieldsFromStruct[order]()}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := table.Iterate(context.Background(), newQueryerDB(t), `SELECT * FROM orders`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*calls) != 0 {
+		t.Fatalf("observed %v before the iteration ended", *calls)
+	}
+	for _, err := range records {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []observed{{op: "Iterate", rows: 2}}; len(*calls) != 1 || (*calls)[0] != want[0] {
+		t.Errorf("observed %v, want %v", *calls, want)
+	}
+	if !strings.Contains(logs.String(), "op=Iterate") || !strings.Contains(logs.String(), "rows=2") {
+		t.Errorf("log %q does not report the iteration", logs.String())
+	}
+
+	*calls = nil
+	if _, err := table.Iterate(context.Background(), nil, `SELECT * FROM orders`); err == nil {
+		t.Fatal("Iterate without a Queryer returned no error")
+	}
+	if len(*calls) != 1 || (*calls)[0].op != "Iterate" || (*calls)[0].err == nil {
+		t.Errorf("observed %v, want the Iterate error", *calls)
+	}
+}
+
+func TestSelectMapsInstrumented(t *testing.T) {
+	calls := observeCalls(t)
+	logs := captureLogs(t)
+	table := &Table[order]{Table: "orders", Fields: FieldsFromStruct[order]()}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := table.SelectMaps(context.Background(), newQueryerDB(t), `SELECT * FROM orders WHERE total > $1`, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1]["note"] != "b" {
+		t.Fatalf("SelectMaps = %v, want the two rows", records)
+	}
+	if want := (observed{op: "SelectMaps", rows: 2}); len(*calls) != 1 || (*calls)[0] != want {
+		t.Errorf("observed %v, want %v", *calls, want)
+	}
+	if !strings.Contains(logs.String(), "op=SelectMaps") || !strings.Contains(logs.String(), "rows=2") {
+		t.Errorf("log %q does not report the query", logs.String())
+	}
+}
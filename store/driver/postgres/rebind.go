@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// reboundDB converts the dollar placeholders of every statement to another bind type.
+type reboundDB struct {
+	db       DB
+	bindType int
+}
+
+// rebound returns db converting the placeholders to the Table BindType. Dollar
+// placeholders are sent unchanged.
+func (t *Table[T]) rebound(db DB) DB {
+	if t.BindType == sqlx.UNKNOWN || t.BindType == sqlx.DOLLAR {
+		return db
+	}
+	return &reboundDB{db: db, bindType: t.BindType}
+}
+
+func (r *reboundDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	query, args, err := Rebind(r.bindType, query, args)
+	if err != nil {
+		return err
+	}
+	return r.db.GetContext(ctx, dest, query, args...)
+}
+
+func (r *reboundDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	query, args, err := Rebind(r.bindType, query, args)
+	if err != nil {
+		return err
+	}
+	return r.db.SelectContext(ctx, dest, query, args...)
+}
+
+func (r *reboundDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query, args, err := Rebind(r.bindType, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return r.db.ExecContext(ctx, query, args...)
+}
+
+// Rebind converts the $1, $2, ... placeholders of query to the sqlx bind type, such
+// as sqlx.QUESTION. Question mark placeholders are not numbered, so the args are
+// reordered and repeated to match the order the placeholders appear in the query.
+// Placeholders inside quoted strings and identifiers are left alone. A query
+// without dollar placeholders is returned unchanged.
+func Rebind(bindType int, query string, args []any) (string, []any, error) {
+	if bindType == sqlx.UNKNOWN || bindType == sqlx.DOLLAR || !strings.Contains(query, "$") {
+		return query, args, nil
+	}
+
+	var b strings.Builder
+	var rebound []any
+	var placeholders int
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			j := i + 1
+			for j < len(query) && isDigit(query[j]) {
+				j++
+			}
+			n, _ := strconv.Atoi(query[i+1 : j])
+			if n < 1 || n > len(args) {
+				return "", nil, fmt.Errorf("placeholder $%d has no argument, got %d arguments", n, len(args))
+			}
+			placeholders++
+			switch bindType {
+			case sqlx.QUESTION:
+				b.WriteString("?")
+				rebound = append(rebound, args[n-1])
+			case sqlx.AT:
+				b.WriteString("@p" + strconv.Itoa(n))
+			case sqlx.NAMED:
+				b.WriteString(":arg" + strconv.Itoa(n))
+			default:
+				return "", nil, fmt.Errorf("unknown bind type %d", bindType)
+			}
+			i = j - 1
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	if placeholders == 0 || bindType != sqlx.QUESTION {
+		return b.String(), args, nil
+	}
+	return b.String(), rebound, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
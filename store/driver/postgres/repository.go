@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+)
+
+// Repository binds a Table to a DB so the table can be used without passing the
+// db on every call. It is a small value and can be copied, use WithTx to run the
+// same operations inside a transaction.
+type Repository[T any] struct {
+	Table *Table[T]
+	DB    DB
+}
+
+// NewRepository returns a Repository for the table using db.
+func NewRepository[T any](table *Table[T], db DB) Repository[T] {
+	return Repository[T]{Table: table, DB: db}
+}
+
+// WithTx returns a copy of the repository using the transaction tx. Repositories of
+// different tables bound to the same tx share the transaction, so several tables can
+// be written atomically inside InTx, which rolls them all back if fn returns an error:
+//
+//	err := postgres.InTx(ctx, db, func(tx postgres.DB) error {
+//		if err := orders.WithTx(tx).Create(ctx, order); err != nil {
+//			return err
+//		}
+//		return items.WithTx(tx).Update(ctx, item)
+//	})
+func (r Repository[T]) WithTx(tx DB) Repository[T] {
+	r.DB = tx
+	return r
+}
+
+// Get fetches a single record by ID(s) with Table.GetByID.
+func (r Repository[T]) Get(ctx context.Context, ids ...interface{}) (*T, error) {
+	return r.Table.GetByID(ctx, r.DB, ids...)
+}
+
+// Create inserts the record with Table.Insert.
+func (r Repository[T]) Create(ctx context.Context, record *T, opts ...QueryOption) error {
+	return r.Table.Insert(ctx, r.DB, record, opts...)
+}
+
+// Update updates the record with Table.Update.
+func (r Repository[T]) Update(ctx context.Context, record *T, opts ...QueryOption) error {
+	return r.Table.Update(ctx, r.DB, record, opts...)
+}
+
+// Delete deletes a single record by ID(s) with Table.DeleteByID.
+func (r Repository[T]) Delete(ctx context.Context, ids ...interface{}) error {
+	return r.Table.DeleteByID(ctx, r.DB, ids...)
+}
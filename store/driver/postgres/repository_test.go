@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/evertonbiviatello/go-commons/store"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// txConnector is a database/sql connector whose statements are only kept if the
+// transaction they run in is committed. Statements for the failTable fail.
+type txConnector struct {
+	failTable string
+
+	mu        sync.Mutex
+	executed  int
+	pending   []string
+	committed []string
+	rollbacks int
+}
+
+func (c *txConnector) Connect(context.Context) (driver.Conn, error) { return &txConn{c: c}, nil }
+func (c *txConnector) Driver() driver.Driver                        { return nil }
+
+type txConn struct{ c *txConnector }
+
+func (conn *txConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (conn *txConn) Close() error                        { return nil }
+func (conn *txConn) Begin() (driver.Tx, error)           { return conn, nil }
+
+func (conn *txConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	conn.c.mu.Lock()
+	defer conn.c.mu.Unlock()
+	if strings.Contains(query, conn.c.failTable) {
+		return nil, &pq.Error{Code: "23505", Constraint: conn.c.failTable + "_pkey"}
+	}
+	conn.c.executed++
+	conn.c.pending = append(conn.c.pending, query)
+	return driver.RowsAffected(1), nil
+}
+
+func (conn *txConn) Commit() error {
+	conn.c.mu.Lock()
+	defer conn.c.mu.Unlock()
+	conn.c.committed = append(conn.c.committed, conn.c.pending...)
+	conn.c.pending = nil
+	return nil
+}
+
+func (conn *txConn) Rollback() error {
+	conn.c.mu.Lock()
+	defer conn.c.mu.Unlock()
+	conn.c.pending = nil
+	conn.c.rollbacks++
+	return nil
+}
+
+type order struct {
+	ID    int64  `db:"id" pk:"true"`
+	Total int64  `db:"total"`
+	Note  string `db:"note"`
+}
+
+type item struct {
+	ID      int64 `db:"id" pk:"true"`
+	OrderID int64 `db:"order_id"`
+}
+
+func TestRepositoryWithTxRollsBackAllTables(t *testing.T) {
+	connector := &txConnector{failTable: "items"}
+	db := sqlx.NewDb(sql.OpenDB(connector), "postgres")
+	defer db.Close()
+
+	orderTable := &Table[order]{Table: "orders", Fields: FieldsFromStruct[order]()}
+	itemTable := &Table[item]{Table: "items", Fields: FieldsFromStruct[item]()}
+	for _, err := range []error{orderTable.Init(), itemTable.Init()} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	orders := NewRepository(orderTable, nil)
+	items := NewRepository(itemTable, nil)
+
+	ctx := context.Background()
+	err := InTx(ctx, db, func(tx DB) error {
+		if err := orders.WithTx(tx).Create(ctx, &order{ID: 1, Total: 10}, QueryOptionIgnoreReturn(true)); err != nil {
+			return err
+		}
+		return items.WithTx(tx).Create(ctx, &item{ID: 1, OrderID: 1}, QueryOptionIgnoreReturn(true))
+	})
+
+	var constraintErr *store.ConstraintError
+	if !errors.As(err, &constraintErr) || constraintErr.Type != store.ErrorTypeDuplicate {
+		t.Fatalf("InTx error = %v, want a duplicate constraint error", err)
+	}
+	if connector.executed != 1 {
+		t.Errorf("executed %d statements, want the orders insert", connector.executed)
+	}
+	if connector.rollbacks != 1 {
+		t.Errorf("rollbacks = %d, want 1", connector.rollbacks)
+	}
+	if len(connector.committed) != 0 {
+		t.Errorf("committed %q, want nothing committed", connector.committed)
+	}
+}
+
+func TestNestedTxDetectsWrappedTransactions(t *testing.T) {
+	connector := &txConnector{failTable: "items"}
+	db := sqlx.NewDb(sql.OpenDB(connector), "postgres")
+	defer db.Close()
+	ctx := context.Background()
+
+	var called bool
+	fn := func(tx DB) error {
+		called = true
+		return nil
+	}
+	if err := NestedTx(ctx, NewCircuitBreakerDB(db, BreakerConfig{}), fn); err == nil || called {
+		t.Fatalf("NestedTx on a wrapped pool = %v, called %v, want an error without calling fn", err, called)
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := NestedTx(ctx, NewCircuitBreakerDB(tx, BreakerConfig{}), fn); err != nil || !called {
+		t.Fatalf("NestedTx on a wrapped transaction = %v, called %v", err, called)
+	}
+	if len(connector.pending) != 2 || !strings.HasPrefix(connector.pending[0], "SAVEPOINT ") || !strings.HasPrefix(connector.pending[1], "RELEASE SAVEPOINT ") {
+		t.Errorf("executed %q, want a savepoint created and released", connector.pending)
+	}
+}
@@ -0,0 +1,27 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+)
+
+// RequestIDKey is the context key of the request id added to the statements logged
+// by SlogLogger as request_id and to the spans started by Tracer as request.id, so
+// queries can be correlated with the request they were run for. It is nil by default
+// so no request id is added. The value can be a string or any fmt.Stringer.
+var RequestIDKey any
+
+// requestID returns the request id of ctx or an empty string if there is none.
+func requestID(ctx context.Context) string {
+	if RequestIDKey == nil {
+		return ""
+	}
+	switch id := ctx.Value(RequestIDKey).(type) {
+	case nil:
+		return ""
+	case string:
+		return id
+	default:
+		return fmt.Sprint(id)
+	}
+}
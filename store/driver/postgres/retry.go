@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/evertonbiviatello/go-commons/store"
+)
+
+var (
+	// RetryBaseDelay is the delay before the first retry. It doubles on every attempt.
+	RetryBaseDelay = 10 * time.Millisecond
+	// RetryMaxDelay is the maximum delay between retries.
+	RetryMaxDelay = time.Second
+)
+
+// IsRetriable returns true if the error is a serialization failure (40001) or a
+// deadlock (40P01) and the operation can be safely retried, either from the driver
+// or wrapped as store.ErrSerialization or store.ErrDeadlock.
+func IsRetriable(err error) bool {
+	if errors.Is(err, store.ErrSerialization) || errors.Is(err, store.ErrDeadlock) {
+		return true
+	}
+	switch SQLState(err) {
+	case pgSerializationFailure, pgDeadlockDetected:
+		return true
+	}
+	return false
+}
+
+// Retry calls fn up to attempts times while it returns a retriable error, waiting
+// with exponential backoff and jitter between attempts. It stops if ctx is done.
+// A transaction body should be retried as a whole, beginning the transaction inside fn:
+//
+//	err := postgres.Retry(ctx, 3, func() error {
+//		tx, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+//		if err != nil {
+//			return err
+//		}
+//		defer tx.Rollback()
+//		if err := table.Update(ctx, tx, record); err != nil {
+//			return err
+//		}
+//		return tx.Commit()
+//	})
+func Retry(ctx context.Context, attempts int, fn func() error) error {
+
+	delay := RetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts || !IsRetriable(err) {
+			return err
+		}
+
+		// Full jitter, sleep somewhere between 0 and delay.
+		timer := time.NewTimer(time.Duration(rand.Int63n(int64(delay) + 1)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		delay *= 2
+		if delay > RetryMaxDelay {
+			delay = RetryMaxDelay
+		}
+	}
+
+}
@@ -1,137 +1,425 @@
 package postgres
 
-//import (
-//	"context"
-//	"fmt"
-//	"strconv"
-//	"strings"
-//
-//	"github.com/snowzach/queryp"
-//	"github.com/snowzach/queryp/qppg"
-//
-//	"github.com/snowzach/golib/store"
-//)
-//
-//type Scanner[T any] interface {
-//	Scan() *T
-//}
-//
-//// Selector is a tool for fetching slices of records based on any query.
-//type Selector[T any] struct {
-//	// The query to use
-//	Query string
-//	// OmitCount will not run the count query
-//	OmitCount bool
-//	// CountQuery allows you to override the query used to obtain counts with the same filter parameters.
-//	// If not specified it will wrap the Query provided in select count(*)
-//	CountQuery string
-//
-//	// The fields you want to allow filtering on and the types
-//	FilterFieldTypes queryp.FilterFieldTypes
-//	// The fields you want to allow sorting on
-//	SortFields queryp.SortFields
-//	// If no sort is provided in the QueryParameters, the default sort to use.
-//	DefaultSort queryp.Sort
-//
-//	// A callback to be used on every record to provide any transformations.
-//	PostProcessRecord func(*T) error
-//	// A callback to be used on the slice of records being returned before they are returned.
-//	PostProcessRecords func([]*T) error
-//}
-//
-//func (s *Selector[T]) Select(ctx context.Context, db DB, qp *queryp.QueryParameters) ([]*T, *int64, error) {
-//	var query strings.Builder
-//	var queryParams []any
-//
-//	query.WriteString(s.Query)
-//
-//	if len(qp.Sort) == 0 && len(s.DefaultSort) > 0 {
-//		qp.Sort = s.DefaultSort
-//	}
-//
-//	if len(qp.Filter) > 0 {
-//		query.WriteString(" WHERE ")
-//	}
-//
-//	if err := qppg.FilterQuery(s.FilterFieldTypes, qp.Filter, &query, &queryParams); err != nil {
-//		return nil, nil, &store.Error{Type: store.ErrorTypeQuery, Err: err}
-//	}
-//	var count *int64
-//	if !s.OmitCount {
-//		count = new(int64)
-//		var countQuery strings.Builder
-//		countQuery.WriteString(`SELECT COUNT(*) AS count FROM (`)
-//		if s.CountQuery != "" {
-//			countQuery.WriteString(s.CountQuery)
-//		} else {
-//			countQuery.WriteString(query.String())
-//		}
-//		countQuery.WriteString(`) _count_query`)
-//
-//		if err := db.GetContext(ctx, count, countQuery.String(), queryParams...); err != nil {
-//			return nil, nil, WrapError(err)
-//		}
-//	}
-//	if err := qppg.SortQuery(s.SortFields, qp.Sort, &query, &queryParams); err != nil {
-//		return nil, nil, &store.Error{Type: store.ErrorTypeQuery, Err: err}
-//	}
-//	if qp.Limit > 0 {
-//		query.WriteString(" LIMIT " + strconv.FormatInt(qp.Limit, 10))
-//	}
-//	if qp.Offset > 0 {
-//		query.WriteString(" OFFSET " + strconv.FormatInt(qp.Offset, 10))
-//	}
-//
-//	var records = make([]*T, 0)
-//	err := db.SelectContext(ctx, &records, query.String(), queryParams...)
-//	if err != nil {
-//		return records, nil, WrapError(err)
-//	}
-//	if s.PostProcessRecord != nil {
-//		for _, record := range records {
-//			if err := s.PostProcessRecord(record); err != nil {
-//				return nil, nil, fmt.Errorf("post proccess record error: %w", err)
-//			}
-//		}
-//	}
-//	if s.PostProcessRecords != nil {
-//		if err := s.PostProcessRecords(records); err != nil {
-//			return nil, nil, fmt.Errorf("post proccess records error: %w", err)
-//		}
-//	}
-//
-//	return records, count, nil
-//
-//}
-//
-//func (s *Selector[T]) SelectFirst(ctx context.Context, db DB, qp *queryp.QueryParameters) (*T, error) {
-//
-//	var query strings.Builder
-//	var queryParams []any
-//
-//	query.WriteString(s.Query)
-//	query.WriteString(" WHERE ")
-//
-//	if err := qppg.FilterQuery(s.FilterFieldTypes, qp.Filter, &query, &queryParams); err != nil {
-//		return nil, &store.Error{Type: store.ErrorTypeQuery, Err: err}
-//	}
-//	if err := qppg.SortQuery(s.SortFields, qp.Sort, &query, &queryParams); err != nil {
-//		return nil, &store.Error{Type: store.ErrorTypeQuery, Err: err}
-//	}
-//
-//	query.WriteString(" LIMIT 1")
-//
-//	var record = new(T)
-//	err := db.GetContext(ctx, record, query.String(), queryParams...)
-//	if err != nil {
-//		return record, WrapError(err)
-//	}
-//	if s.PostProcessRecord != nil {
-//		if err := s.PostProcessRecord(record); err != nil {
-//			return nil, fmt.Errorf("post proccess record error: %w", err)
-//		}
-//	}
-//
-//	return record, nil
-//
-//}
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/evertonbiviatello/go-commons/store"
+	"github.com/lib/pq"
+)
+
+// FilterOp is the comparison operator used by a Filter.
+type FilterOp string
+
+const (
+	FilterOpEquals           FilterOp = "="
+	FilterOpNotEquals        FilterOp = "!="
+	FilterOpLessThan         FilterOp = "<"
+	FilterOpLessThanEqual    FilterOp = "<="
+	FilterOpGreaterThan      FilterOp = ">"
+	FilterOpGreaterThanEqual FilterOp = ">="
+	FilterOpLike             FilterOp = "LIKE"
+	FilterOpILike            FilterOp = "ILIKE"
+	// FilterOpIn and FilterOpNotIn compare a field to the elements of a slice Value
+	// with = ANY and <> ALL.
+	FilterOpIn    FilterOp = "IN"
+	FilterOpNotIn FilterOp = "NOT IN"
+)
+
+// Filter compares a field to a value. A nil Value with FilterOpEquals or
+// FilterOpNotEquals is translated to IS NULL and IS NOT NULL.
+type Filter struct {
+	Field string
+	Op    FilterOp
+	Value any
+}
+
+// WhereIn returns a condition matching column to any of the values and its argument,
+// for a query where it is the positional argument n. The values are bound as a
+// single array with col = ANY($n) so the query does not depend on their number. An
+// empty slice matches nothing.
+func WhereIn[V any](column string, values []V, n int) (string, []any) {
+	return column + " = ANY($" + strconv.Itoa(n) + ")", []any{pq.Array(values)}
+}
+
+// WhereNotIn returns a condition matching column to none of the values like WhereIn,
+// using col <> ALL($n). An empty slice matches everything except NULL.
+func WhereNotIn[V any](column string, values []V, n int) (string, []any) {
+	return column + " <> ALL($" + strconv.Itoa(n) + ")", []any{pq.Array(values)}
+}
+
+// WhereInExpanded returns a condition matching column to any of the values with one
+// positional argument per value starting at n, col IN ($n,$n+1,...), for drivers or
+// types that cannot bind arrays. An empty slice is FALSE as IN () is not valid.
+func WhereInExpanded[V any](column string, values []V, n int) (string, []any) {
+	if len(values) == 0 {
+		return "FALSE", nil
+	}
+	var b strings.Builder
+	args := make([]any, len(values))
+	b.WriteString(column)
+	b.WriteString(" IN (")
+	for i, value := range values {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("$")
+		b.WriteString(strconv.Itoa(n + i))
+		args[i] = value
+	}
+	b.WriteString(")")
+	return b.String(), args
+}
+
+// NullsOrder is where null values are sorted by an OrderBy.
+type NullsOrder string
+
+const (
+	// NullsDefault uses the postgres default, nulls are last ascending and first descending.
+	NullsDefault NullsOrder = ""
+	NullsFirst   NullsOrder = "FIRST"
+	NullsLast    NullsOrder = "LAST"
+)
+
+// OrderBy sorts the results by a field.
+type OrderBy struct {
+	Field string
+	Desc  bool
+	Nulls NullsOrder
+}
+
+// QueryParams are the filter, sort and pagination parameters used by a Selector.
+// Filters are combined with AND. DistinctOn keeps only the first row of each set of
+// rows with equal values of the fields, using SELECT DISTINCT ON. A Limit or Offset
+// without a Sort sorts by the IDs so pages do not overlap.
+type QueryParams struct {
+	Filter     []Filter
+	Sort       []OrderBy
+	Limit      int64
+	Offset     int64
+	DistinctOn []string
+}
+
+// filterKeyOps maps the operator suffixes accepted by SelectWhere to their FilterOp.
+var filterKeyOps = map[string]FilterOp{
+	"eq":    FilterOpEquals,
+	"ne":    FilterOpNotEquals,
+	"lt":    FilterOpLessThan,
+	"lte":   FilterOpLessThanEqual,
+	"gt":    FilterOpGreaterThan,
+	"gte":   FilterOpGreaterThanEqual,
+	"like":  FilterOpLike,
+	"ilike": FilterOpILike,
+	"in":    FilterOpIn,
+	"nin":   FilterOpNotIn,
+}
+
+// parseFilterKey splits a SelectWhere key into the field name and operator.
+func parseFilterKey(key string) (string, FilterOp, error) {
+	field, suffix, found := strings.Cut(key, "__")
+	if !found {
+		return key, FilterOpEquals, nil
+	}
+	op, ok := filterKeyOps[suffix]
+	if !ok {
+		return "", "", fmt.Errorf("unknown filter operator %s for field %s", suffix, field)
+	}
+	return field, op, nil
+}
+
+// SelectOption sets the sort and pagination of a SelectWhere.
+type SelectOption func(qp *QueryParams) error
+
+func SelectOptionSort(sort ...OrderBy) SelectOption {
+	return func(qp *QueryParams) error {
+		qp.Sort = sort
+		return nil
+	}
+}
+
+func SelectOptionDistinctOn(fields ...string) SelectOption {
+	return func(qp *QueryParams) error {
+		qp.DistinctOn = fields
+		return nil
+	}
+}
+
+func SelectOptionLimit(limit int64) SelectOption {
+	return func(qp *QueryParams) error {
+		if limit < 0 {
+			return fmt.Errorf("invalid limit %d", limit)
+		}
+		qp.Limit = limit
+		return nil
+	}
+}
+
+func SelectOptionOffset(offset int64) SelectOption {
+	return func(qp *QueryParams) error {
+		if offset < 0 {
+			return fmt.Errorf("invalid offset %d", offset)
+		}
+		qp.Offset = offset
+		return nil
+	}
+}
+
+// Selector is a tool for fetching slices of records based on any query.
+type Selector[T any] struct {
+	// The query to use. It should not include a WHERE clause.
+	Query string
+	// Where is an optional condition that is always applied.
+	Where string
+	// Fields maps the field names allowed for filtering and sorting to the
+	// column they reference. Any other field name is rejected.
+	Fields map[string]string
+	// If no sort is provided in the QueryParams, the default sort to use.
+	DefaultSort []OrderBy
+	// IDs are the columns appended to any sort so the order is deterministic
+	// when the sorted values are equal.
+	IDs []string
+
+	// A callback to be used on every record to provide any transformations.
+	PostProcessRecord func(*T) error
+	// PostProcessRecordCtx is like PostProcessRecord but receives the context of
+	// the call. It is used instead of PostProcessRecord when both are set.
+	PostProcessRecordCtx func(ctx context.Context, record *T) error
+}
+
+// Select fetches the records matching the query parameters.
+func (s *Selector[T]) Select(ctx context.Context, db DB, qp QueryParams) ([]*T, error) {
+
+	query, queryParams, err := s.Build(qp)
+	if err != nil {
+		return nil, err
+	}
+
+	var records = make([]*T, 0)
+	if err := db.SelectContext(ctx, &records, query, queryParams...); err != nil {
+		return nil, wrapQueryError(ctx, err)
+	}
+	if postProcessRecord := postProcessRecordFunc(s.PostProcessRecordCtx, s.PostProcessRecord); postProcessRecord != nil {
+		for _, record := range records {
+			if err := postProcessRecord(ctx, record); err != nil {
+				return nil, fmt.Errorf("post process record error: %w", err)
+			}
+		}
+	}
+
+	return records, nil
+
+}
+
+// Build returns the query and arguments Select runs for the query parameters.
+// Unknown fields and operators return a store.Error.
+func (s *Selector[T]) Build(qp QueryParams) (string, []any, error) {
+
+	var query strings.Builder
+	var queryParams []any
+
+	if err := s.writeSelect(&query, qp.DistinctOn); err != nil {
+		return "", nil, &store.Error{Type: store.ErrorTypeQuery, Err: err}
+	}
+
+	if err := s.writeWhere(&query, &queryParams, qp.Filter); err != nil {
+		return "", nil, &store.Error{Type: store.ErrorTypeQuery, Err: err}
+	}
+
+	sort := qp.Sort
+	if len(sort) == 0 {
+		sort = s.DefaultSort
+	}
+	sort = distinctSort(sort, qp.DistinctOn)
+	if err := s.writeOrderBy(&query, sort, qp.Limit > 0 || qp.Offset > 0); err != nil {
+		return "", nil, &store.Error{Type: store.ErrorTypeQuery, Err: err}
+	}
+	if qp.Limit > 0 {
+		query.WriteString(" LIMIT " + strconv.FormatInt(qp.Limit, 10))
+	}
+	if qp.Offset > 0 {
+		query.WriteString(" OFFSET " + strconv.FormatInt(qp.Offset, 10))
+	}
+	return query.String(), queryParams, nil
+
+}
+
+// writeSelect writes the Query, adding DISTINCT ON the columns of the fields after
+// its SELECT keyword.
+func (s *Selector[T]) writeSelect(b *strings.Builder, distinctOn []string) error {
+
+	if len(distinctOn) == 0 {
+		b.WriteString(s.Query)
+		return nil
+	}
+	const selectKeyword = "SELECT "
+	if len(s.Query) < len(selectKeyword) || !strings.EqualFold(s.Query[:len(selectKeyword)], selectKeyword) {
+		return fmt.Errorf("distinct on requires a query starting with SELECT")
+	}
+	b.WriteString(s.Query[:len(selectKeyword)])
+	b.WriteString("DISTINCT ON (")
+	for i, field := range distinctOn {
+		column, ok := s.Fields[field]
+		if !ok {
+			return fmt.Errorf("unknown distinct field %s", field)
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(column)
+	}
+	b.WriteString(") ")
+	b.WriteString(s.Query[len(selectKeyword):])
+	return nil
+
+}
+
+// distinctSort returns the sort starting with the distinct fields, as postgres
+// requires the ORDER BY to start with the DISTINCT ON expressions. Distinct fields
+// moved to the start keep their direction and the others are sorted ascending.
+func distinctSort(sort []OrderBy, distinctOn []string) []OrderBy {
+
+	if len(distinctOn) == 0 {
+		return sort
+	}
+	distinct := make(map[string]bool, len(distinctOn))
+	for _, field := range distinctOn {
+		distinct[field] = true
+	}
+	var leading int
+	for leading < len(sort) && distinct[sort[leading].Field] {
+		delete(distinct, sort[leading].Field)
+		leading++
+	}
+	result := make([]OrderBy, 0, len(distinctOn)+len(sort))
+	result = append(result, sort[:leading]...)
+	for _, field := range distinctOn {
+		if !distinct[field] {
+			continue
+		}
+		orderBy := OrderBy{Field: field}
+		for _, sorted := range sort[leading:] {
+			if sorted.Field == field {
+				orderBy = sorted
+				break
+			}
+		}
+		result = append(result, orderBy)
+		delete(distinct, field)
+	}
+	for _, orderBy := range sort[leading:] {
+		if !slices.Contains(distinctOn, orderBy.Field) {
+			result = append(result, orderBy)
+		}
+	}
+	return result
+
+}
+
+// writeWhere writes the WHERE clause for the filters and appends the values to params.
+func (s *Selector[T]) writeWhere(b *strings.Builder, params *[]any, filters []Filter) error {
+
+	if s.Where == "" && len(filters) == 0 {
+		return nil
+	}
+	b.WriteString(" WHERE ")
+	if s.Where != "" {
+		b.WriteString(s.Where)
+	}
+	for i, filter := range filters {
+		column, ok := s.Fields[filter.Field]
+		if !ok {
+			return fmt.Errorf("unknown filter field %s", filter.Field)
+		}
+		if i > 0 || s.Where != "" {
+			b.WriteString(" AND ")
+		}
+		b.WriteString(column)
+		switch filter.Op {
+		case FilterOpEquals, FilterOpNotEquals:
+			if filter.Value == nil {
+				if filter.Op == FilterOpEquals {
+					b.WriteString(" IS NULL")
+				} else {
+					b.WriteString(" IS NOT NULL")
+				}
+				continue
+			}
+		case FilterOpIn, FilterOpNotIn:
+			if kind := reflect.ValueOf(filter.Value).Kind(); kind != reflect.Slice && kind != reflect.Array {
+				return fmt.Errorf("filter operator %s for field %s requires a slice, got %T", filter.Op, filter.Field, filter.Value)
+			}
+			*params = append(*params, pq.Array(filter.Value))
+			if filter.Op == FilterOpIn {
+				b.WriteString(" = ANY($")
+			} else {
+				b.WriteString(" <> ALL($")
+			}
+			b.WriteString(strconv.Itoa(len(*params)))
+			b.WriteString(")")
+			continue
+		case FilterOpLessThan, FilterOpLessThanEqual, FilterOpGreaterThan, FilterOpGreaterThanEqual, FilterOpLike, FilterOpILike:
+		default:
+			return fmt.Errorf("unknown filter operator %s for field %s", filter.Op, filter.Field)
+		}
+		*params = append(*params, filter.Value)
+		b.WriteString(" ")
+		b.WriteString(string(filter.Op))
+		b.WriteString(" $")
+		b.WriteString(strconv.Itoa(len(*params)))
+	}
+	return nil
+
+}
+
+// writeOrderBy writes the ORDER BY clause followed by any IDs not already sorted.
+// Without a sort the IDs are only written if the query is paged by a LIMIT or
+// OFFSET, so the pages are stable.
+func (s *Selector[T]) writeOrderBy(b *strings.Builder, sort []OrderBy, paged bool) error {
+
+	if len(sort) == 0 && (!paged || len(s.IDs) == 0) {
+		return nil
+	}
+	b.WriteString(" ORDER BY ")
+	sorted := make(map[string]bool, len(sort))
+	for i, orderBy := range sort {
+		column, ok := s.Fields[orderBy.Field]
+		if !ok {
+			return fmt.Errorf("unknown sort field %s", orderBy.Field)
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(column)
+		if orderBy.Desc {
+			b.WriteString(" DESC")
+		} else {
+			b.WriteString(" ASC")
+		}
+		switch orderBy.Nulls {
+		case NullsDefault:
+		case NullsFirst, NullsLast:
+			b.WriteString(" NULLS ")
+			b.WriteString(string(orderBy.Nulls))
+		default:
+			return fmt.Errorf("unknown nulls order %s for field %s", orderBy.Nulls, orderBy.Field)
+		}
+		sorted[column] = true
+	}
+	written := len(sort)
+	for _, column := range s.IDs {
+		if !sorted[column] {
+			if written > 0 {
+				b.WriteString(",")
+			}
+			written++
+			b.WriteString(column)
+			b.WriteString(" ASC")
+		}
+	}
+	return nil
+
+}
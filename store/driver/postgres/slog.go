@@ -0,0 +1,156 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"time"
+)
+
+// SlogLogger logs every statement run by a Table at debug level with the operation,
+// table, query, arguments, duration, rows and error. It is nil by default so nothing
+// is logged. Arguments bound from fields matching RedactPattern are redacted, and
+// arguments that are not bound from a known field are redacted unless
+// LogUnnamedArgs is set.
+var SlogLogger *slog.Logger
+
+// SlowQueryThreshold logs statements that take at least as long at warning level to
+// SlogLogger, with the same attributes as the debug log, as a cheap signal of
+// regressions. Zero disables it.
+var SlowQueryThreshold time.Duration
+
+// RedactPattern matches the names of fields whose arguments are redacted from logs.
+var RedactPattern = regexp.MustCompile(`(?i)password|passwd|secret|token|api_?key`)
+
+// LogUnnamedArgs logs the arguments of statements whose field names are not known,
+// such as those of SelectByQuery or a caller's WHERE clause, in the clear. They are
+// redacted by default as they may hold secrets.
+var LogUnnamedArgs bool
+
+// loggingDB logs the statements run for a single Table operation.
+type loggingDB struct {
+	db     DB
+	logger *slog.Logger
+	op     string
+	table  string
+	// names are the field names of the positional arguments, repeated for batches.
+	names []string
+}
+
+// logged returns db logging the statements for the operation if SlogLogger is set. The
+// names are the field names of the positional arguments if they are known.
+func (t *Table[T]) logged(db DB, op string, names []string) DB {
+	if SlogLogger == nil {
+		return db
+	}
+	return &loggingDB{db: db, logger: SlogLogger, op: op, table: t.qualifiedName(), names: names}
+}
+
+func (l *loggingDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	start := time.Now()
+	err := l.db.GetContext(ctx, dest, query, args...)
+	var rows int64
+	if err == nil {
+		rows = 1
+	}
+	l.log(ctx, query, args, start, rows, err)
+	return err
+}
+
+func (l *loggingDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	start := time.Now()
+	err := l.db.SelectContext(ctx, dest, query, args...)
+	var rows int64
+	if value := reflect.ValueOf(dest); value.Kind() == reflect.Ptr && value.Elem().Kind() == reflect.Slice {
+		rows = int64(value.Elem().Len())
+	}
+	l.log(ctx, query, args, start, rows, err)
+	return err
+}
+
+func (l *loggingDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := l.db.ExecContext(ctx, query, args...)
+	var rows int64
+	if err == nil {
+		rows, _ = result.RowsAffected()
+	}
+	l.log(ctx, query, args, start, rows, err)
+	return result, err
+}
+
+func (l *loggingDB) log(ctx context.Context, query string, args []any, start time.Time, rows int64, err error) {
+	duration := time.Since(start)
+	slow := SlowQueryThreshold > 0 && duration >= SlowQueryThreshold
+	if !slow && !l.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("op", l.op),
+		slog.String("table", l.table),
+		slog.String("query", query),
+		slog.Any("args", l.redact(args)),
+		slog.Duration("duration", duration),
+		slog.Int64("rows", rows),
+	}
+	if id := requestID(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	l.logger.LogAttrs(ctx, slog.LevelDebug, "postgres query", attrs...)
+	if slow {
+		l.logger.LogAttrs(ctx, slog.LevelWarn, "postgres slow query", attrs...)
+	}
+}
+
+// logQuery logs a statement that is not run through a DB, such as with a Queryer,
+// if SlogLogger is set.
+func (t *Table[T]) logQuery(ctx context.Context, op string, query string, args []any, start time.Time, rows int64, err error) {
+	if SlogLogger == nil {
+		return
+	}
+	l := &loggingDB{logger: SlogLogger, op: op, table: t.qualifiedName()}
+	l.log(ctx, query, args, start, rows, err)
+}
+
+// redact returns a copy of args with the arguments of secret fields replaced. If
+// the names are not known every argument is replaced unless LogUnnamedArgs is set.
+func (l *loggingDB) redact(args []any) []any {
+	if len(l.names) == 0 && LogUnnamedArgs {
+		return args
+	}
+	redacted := make([]any, len(args))
+	for i, arg := range args {
+		if len(l.names) == 0 || RedactPattern.MatchString(l.names[i%len(l.names)]) {
+			arg = "[REDACTED]"
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
+
+// argNames returns the field name of each positional argument of the statement.
+func (t *Table[T]) argNames(op writeOp) []string {
+	var names []string
+	for _, field := range t.Fields {
+		for i := t.argCount(field, op); i > 0; i-- {
+			names = append(names, field.Name)
+		}
+	}
+	return names
+}
+
+// idNames returns the names of the ID fields.
+func (t *Table[T]) idNames() []string {
+	var names []string
+	for _, field := range t.Fields {
+		if field.ID {
+			names = append(names, field.Name)
+		}
+	}
+	return names
+}
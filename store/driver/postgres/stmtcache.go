@@ -0,0 +1,205 @@
+package postgres
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultStmtCacheSize is the number of statements cached by NewStmtCacheDB.
+const DefaultStmtCacheSize = 256
+
+// Preparer is implemented by *sqlx.DB and *sqlx.Tx.
+type Preparer interface {
+	PreparexContext(ctx context.Context, query string) (*sqlx.Stmt, error)
+}
+
+// StmtCacheDB is a DB that prepares each query the first time it is used and reuses
+// the prepared statement afterwards, saving the parse on every call. It should wrap
+// a connection pool such as *sqlx.DB and be shared by all tables using that pool. If
+// the wrapped DB does not implement Preparer, queries are run without preparing.
+// At most size statements are cached, the least recently used statement is closed
+// once it is no longer in use when another is prepared.
+type StmtCacheDB struct {
+	db       DB
+	preparer Preparer
+	size     int
+
+	mu    sync.Mutex
+	order *list.List // of *cachedStmt, most recently used first
+	stmts map[string]*list.Element
+}
+
+// cachedStmt is a statement in the cache. It is closed once it is evicted and no
+// call is using it.
+type cachedStmt struct {
+	query   string
+	stmt    *sqlx.Stmt
+	refs    int
+	evicted bool
+}
+
+var _ DB = (*StmtCacheDB)(nil)
+
+// NewStmtCacheDB returns a DB caching up to DefaultStmtCacheSize prepared statements
+// for db.
+func NewStmtCacheDB(db DB) *StmtCacheDB {
+	return NewStmtCacheDBSize(db, DefaultStmtCacheSize)
+}
+
+// NewStmtCacheDBSize returns a DB caching up to size prepared statements for db. A
+// size less than one caches a single statement.
+func NewStmtCacheDBSize(db DB, size int) *StmtCacheDB {
+	c := &StmtCacheDB{db: db, size: max(size, 1), order: list.New(), stmts: map[string]*list.Element{}}
+	c.preparer, _ = db.(Preparer)
+	return c
+}
+
+func (c *StmtCacheDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	stmt, err := c.stmt(ctx, query)
+	if err != nil {
+		return err
+	}
+	if stmt == nil {
+		return c.db.GetContext(ctx, dest, query, args...)
+	}
+	defer c.release(stmt)
+	return stmt.stmt.GetContext(ctx, dest, args...)
+}
+
+func (c *StmtCacheDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	stmt, err := c.stmt(ctx, query)
+	if err != nil {
+		return err
+	}
+	if stmt == nil {
+		return c.db.SelectContext(ctx, dest, query, args...)
+	}
+	defer c.release(stmt)
+	return stmt.stmt.SelectContext(ctx, dest, args...)
+}
+
+func (c *StmtCacheDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := c.stmt(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return c.db.ExecContext(ctx, query, args...)
+	}
+	defer c.release(stmt)
+	return stmt.stmt.ExecContext(ctx, args...)
+}
+
+// InTransaction returns true if the wrapped DB is a transaction.
+func (c *StmtCacheDB) InTransaction() bool {
+	return inTransaction(c.db)
+}
+
+// stmt returns the prepared statement for query, preparing it if needed, which must
+// be released after use. It returns nil if the DB does not support preparing
+// statements.
+func (c *StmtCacheDB) stmt(ctx context.Context, query string) (*cachedStmt, error) {
+	if c.preparer == nil {
+		return nil, nil
+	}
+	if cached := c.acquire(query); cached != nil {
+		return cached, nil
+	}
+	stmt, err := c.preparer.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, WrapError(err)
+	}
+
+	c.mu.Lock()
+	if elem, ok := c.stmts[query]; ok {
+		// Prepared concurrently, keep the stored statement.
+		existing := c.use(elem)
+		c.mu.Unlock()
+		stmt.Close()
+		return existing, nil
+	}
+	cached := &cachedStmt{query: query, stmt: stmt, refs: 1}
+	c.stmts[query] = c.order.PushFront(cached)
+	var evicted []*cachedStmt
+	for c.order.Len() > c.size {
+		oldest := c.order.Remove(c.order.Back()).(*cachedStmt)
+		delete(c.stmts, oldest.query)
+		oldest.evicted = true
+		if oldest.refs == 0 {
+			evicted = append(evicted, oldest)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, stmt := range evicted {
+		stmt.stmt.Close()
+	}
+	return cached, nil
+}
+
+// acquire returns the cached statement for query marked as in use, or nil if it is
+// not cached.
+func (c *StmtCacheDB) acquire(query string) *cachedStmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.stmts[query]
+	if !ok {
+		return nil
+	}
+	return c.use(elem)
+}
+
+// use marks the statement in elem as in use and most recently used. c.mu must be held.
+func (c *StmtCacheDB) use(elem *list.Element) *cachedStmt {
+	c.order.MoveToFront(elem)
+	cached := elem.Value.(*cachedStmt)
+	cached.refs++
+	return cached
+}
+
+// release marks a use of the statement done, closing it if it was evicted meanwhile.
+func (c *StmtCacheDB) release(cached *cachedStmt) {
+	c.mu.Lock()
+	cached.refs--
+	closing := cached.evicted && cached.refs == 0
+	c.mu.Unlock()
+	if closing {
+		cached.stmt.Close()
+	}
+}
+
+// ClearStatements closes and removes all cached statements. Statements in use are
+// closed once the call using them returns. Statements are prepared again the next
+// time they are used.
+func (c *StmtCacheDB) ClearStatements() error {
+	c.mu.Lock()
+	var closing []*cachedStmt
+	for elem := c.order.Front(); elem != nil; elem = elem.Next() {
+		cached := elem.Value.(*cachedStmt)
+		cached.evicted = true
+		if cached.refs == 0 {
+			closing = append(closing, cached)
+		}
+	}
+	c.order.Init()
+	clear(c.stmts)
+	c.mu.Unlock()
+
+	var errs []error
+	for _, cached := range closing {
+		if err := cached.stmt.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes all cached statements. It does not close the wrapped DB.
+func (c *StmtCacheDB) Close() error {
+	return c.ClearStatements()
+}
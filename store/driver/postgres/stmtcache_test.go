@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/evertonbiviatello/go-commons/store"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// stmtConnector is a database/sql connector recording the statements prepared and
+// closed. Preparing fails with prepareErr if it is set.
+type stmtConnector struct {
+	prepareErr error
+
+	mu       sync.Mutex
+	prepared []string
+	closed   []string
+}
+
+func (c *stmtConnector) Connect(context.Context) (driver.Conn, error) { return &stmtConn{c: c}, nil }
+func (c *stmtConnector) Driver() driver.Driver                        { return nil }
+
+type stmtConn struct{ c *stmtConnector }
+
+func (conn *stmtConn) Prepare(query string) (driver.Stmt, error) {
+	conn.c.mu.Lock()
+	defer conn.c.mu.Unlock()
+	if conn.c.prepareErr != nil {
+		return nil, conn.c.prepareErr
+	}
+	conn.c.prepared = append(conn.c.prepared, query)
+	return &stmtStmt{c: conn.c, query: query}, nil
+}
+func (conn *stmtConn) Close() error              { return nil }
+func (conn *stmtConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type stmtStmt struct {
+	c     *stmtConnector
+	query string
+}
+
+func (s *stmtStmt) Close() error {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	s.c.closed = append(s.c.closed, s.query)
+	return nil
+}
+func (s *stmtStmt) NumInput() int                              { return -1 }
+func (s *stmtStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (s *stmtStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestStmtCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	connector := &stmtConnector{}
+	db := sqlx.NewDb(sql.OpenDB(connector), "postgres")
+	defer db.Close()
+	cache := NewStmtCacheDBSize(db, 2)
+
+	ctx := context.Background()
+	for _, query := range []string{"q1", "q2", "q1", "q3", "q1"} {
+		if _, err := cache.ExecContext(ctx, query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"q1", "q2", "q3"}; !slices.Equal(connector.prepared, want) {
+		t.Errorf("prepared %q, want %q", connector.prepared, want)
+	}
+	if want := []string{"q2"}; !slices.Equal(connector.closed, want) {
+		t.Errorf("closed %q, want the least recently used %q", connector.closed, want)
+	}
+
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(connector.closed)
+	if want := []string{"q1", "q2", "q3"}; !slices.Equal(connector.closed, want) {
+		t.Errorf("closed %q after Close, want %q", connector.closed, want)
+	}
+}
+
+func TestStmtCacheWrapsPrepareError(t *testing.T) {
+	connector := &stmtConnector{prepareErr: &pq.Error{Code: "57014"}}
+	db := sqlx.NewDb(sql.OpenDB(connector), "postgres")
+	defer db.Close()
+
+	_, err := NewStmtCacheDB(db).ExecContext(context.Background(), "q1")
+	if !errors.Is(err, store.ErrTimeout) {
+		t.Errorf("ExecContext error = %v, want store.ErrTimeout", err)
+	}
+}
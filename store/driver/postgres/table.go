@@ -3,39 +3,84 @@ package postgres
 import (
 	"context"
 	"database/sql/driver"
+	"errors"
 	"fmt"
+	"iter"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/evertonbiviatello/go-commons/store"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 const Value = "$#"
 
+// MaxParameters is the maximum number of positional parameters postgres allows in a single statement.
+const MaxParameters = 65535
+
 // Table is the query builder table representation.
 type Table[T any] struct {
 	// Schema to use if you want to hard code it
 	Schema string
 	// Table name
 	Table string
+	// Alias is used to reference the table in generated queries. It is needed
+	// for self joins or to avoid ambiguous columns. Defaults to the table name.
+	Alias string
 	// The fields you wish to reference for select, insert and update operations
 	Fields []*Field[T]
 	// Additional joins when fetching data from the table
 	Joins string
+	// Structured joins added after Joins when fetching data from the table, so
+	// they can be composed by code.
+	StructuredJoins []Join
+	// SoftDeleteColumn is an optional timestamp column used to mark records as
+	// deleted. When set, DeleteByID sets it to now() instead of removing the row
+	// and the generated get, count and update queries exclude records where it is
+	// not null.
+	SoftDeleteColumn string
+	// VersionColumn is an optional field used for optimistic locking. When set, Update
+	// only succeeds if the version matches the record and increments it. If the record
+	// exists with a different version store.ErrConcurrentModification is returned.
+	// The field must have a Value function returning the current version.
+	VersionColumn string
+	// BindType is the sqlx bind type of the placeholders sent to the database, for
+	// example sqlx.BindType(driverName) or sqlx.QUESTION. Queries are written with
+	// dollar placeholders and rebound when they are run. Defaults to sqlx.DOLLAR.
+	BindType int
+	// UTC converts every time.Time field of a record read from the table to UTC,
+	// including nested structs, so times do not depend on the session time zone.
+	// Use TimeField to also convert the values written.
+	UTC bool
 
 	// Selector is a tool for fetching multiple rows from a table, using
-	// queryp to filter results.
-	//Selector[T]
-	//
-	//// Scanner is used
-	//Scanner Scanner[T]
+	// QueryParams to filter results. If not specified it will be generated
+	// from the fields provided above.
+	Selector Selector[T]
 
+	// This is a callback that is used before a record is inserted, updated or
+	// upserted, before the field values are fetched from it.
+	PreProcessRecord func(*T) error
 	// This is a callback that is used after fetching a row of data before
 	// returning it.
 	PostProcessRecord func(*T) error
+	// PostProcessRecordCtx is like PostProcessRecord but receives the context of
+	// the call. It is used instead of PostProcessRecord when both are set.
+	PostProcessRecordCtx func(ctx context.Context, record *T) error
+
+	// DefaultOptions are applied to every call taking QueryOptions before the options
+	// of the call, which override them. They set table wide policies such as a
+	// Timeout or IgnoreReturn.
+	DefaultOptions []QueryOption
 
 	// The select portion of the query for just the fields in this table.
 	// It should not include the SELECT keyword, just comma separated fields.
 	// If this is not specified it will be built automatically based on the fields
-	// provided above.
+	// provided above, qualified with the Alias or table name so they can be used
+	// with Joins.
 	SelectFields string
 	// Additional fields you wish to select from the main query. Generally
 	// associated with the Joins but could be anything. Just provide comma
@@ -59,6 +104,10 @@ type Table[T any] struct {
 type Field[T any] struct {
 	// The field name
 	Name string
+	// Alias is the name the column is selected and returned as when it differs from
+	// the `db` tag of the record field it is scanned into, for example "modified" for
+	// an updated_at column. Defaults to the Name.
+	Alias string
 	// Is this field part of the record ID (a primary key). You can have
 	// multiple ID fields on a record.
 	ID bool
@@ -71,178 +120,2193 @@ type Field[T any] struct {
 	// The value to use when updating this field in the database. If you want
 	// to use a positional argument, use the `Value` constant.
 	Update string
+	// UpsertUpdate marks the field as set on conflict by an Upsert, from its Update
+	// or the EXCLUDED row if it has none. If no field is marked every field with an
+	// Update is set, so marking fields leaves the others, such as created_at, unchanged.
+	// The ConflictUpdate option overrides it.
+	UpsertUpdate bool
+	// Generated marks a GENERATED ALWAYS column. It is selected and returned but left
+	// out of inserts and updates whatever its Insert and Update are, and naming it in
+	// UpdateFields or UpdateByQuery is an error.
+	Generated bool
 	// This function is used to fetch the value for insert or update from a record.
+	// A driver.Valuer, such as an enum type, is passed to the driver as is.
 	Value func(*T) (driver.Value, error)
+	// Cast is the postgres type the positional argument of a field with a Value
+	// function is cast to, for example the name of an enum type, written as
+	// $1::mood so the driver does not need to infer it.
+	Cast string
+	// This function is used instead of Value when the Insert or Update expression
+	// binds more than one positional argument, for example
+	// `ST_SetSRID(ST_MakePoint($#, $#), 4326)`. Each `Value` constant in the
+	// expression is bound to the next value returned.
+	Values func(*T) ([]driver.Value, error)
+	// PgType is the postgres type of the field, for example "text" or "bigint". It
+	// is required to bind the field as an array in InsertUnnest and by CreateTableDDL.
+	PgType string
+	// NotNull marks the column NOT NULL in the CreateTableDDL. ID fields are always
+	// not null as they are the primary key.
+	NotNull bool
+	// This function is used to validate each value fetched by Value or Values for
+	// an insert or update before the query is run. A failure returns a store.Error
+	// of type store.ErrorTypeInvalid naming the field.
+	Validate func(driver.Value) error
+	// This function is used to transform the record after it is read, for example
+	// decoding a scanned column into another struct field. It runs before the
+	// table PostProcessRecord for every record returned.
+	Scan func(*T) error
+	// AllowedValues is the set of values a string column may contain. When set,
+	// the value read by Value is checked after every read and an error naming the
+	// value is returned if it is not in the set, for example after a bad migration.
+	// Null values are not checked.
+	AllowedValues []string
 	// This is used to determine the value that should be returned if the
 	// value is being returned in a COALESCED way. For example, if you left join this
 	// table and there is no value, this would be the value returned if you use the
 	// GenerateAdditionalFields(coalesce=true) to generate the AdditionalFields
 	// string
 	NullVal any
+
+	// err is set by the field constructors if the field cannot work, so Init
+	// returns it instead of the first query using the field.
+	err error
 }
 
-// GetByID fetches a single record by ID(s)
+// GetByID fetches a single record by ID(s). The ids are bound to $1, $2, ... in the
+// order the ID fields are declared, so a custom GetByIDQuery must use the same order.
+// It returns store.ErrNotFound if there is no record with the ID(s) and a store.Error
+// if the number of ids does not match the number of ID fields.
 func (t *Table[T]) GetByID(ctx context.Context, db DB, ids ...interface{}) (*T, error) {
-	var record = new(T)
-	err := db.GetContext(ctx, record, t.GetByIDQuery, ids...)
+	return t.GetByIDWithOpts(ctx, db, ids)
+}
+
+// GetByIDForUpdate fetches a single record by ID(s) like GetByID and locks the row
+// with SELECT ... FOR UPDATE until the end of the transaction. It should be called
+// inside a transaction such as InTx for read-modify-write flows.
+func (t *Table[T]) GetByIDForUpdate(ctx context.Context, db DB, ids ...interface{}) (*T, error) {
+	return t.GetByIDWithOpts(ctx, db, ids, QueryOptionLock(LockForUpdate))
+}
+
+// Refresh reloads the record in place from the row with the ID(s) of its ID fields,
+// for example after it was updated elsewhere. The record is replaced by the row read
+// by GetByID. It returns store.ErrNotFound if the row no longer exists, leaving the
+// record unchanged.
+func (t *Table[T]) Refresh(ctx context.Context, db DB, record *T) error {
+	ids, err := t.idArgs(record)
 	if err != nil {
-		return nil, WrapError(err)
+		return err
+	}
+	fresh, err := t.GetByIDWithOpts(ctx, db, ids)
+	if err != nil {
+		return err
+	}
+	*record = *fresh
+	return nil
+}
+
+// GetByIDWithOpts fetches a single record by ID(s) like GetByID with query options.
+// A Lock only locks the rows of this table, not any joined tables.
+func (t *Table[T]) GetByIDWithOpts(ctx context.Context, db DB, ids []interface{}, opts ...QueryOption) (_ *T, err error) {
+	var rows int64
+	if Observer != nil {
+		defer t.observe("GetByID", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "GetByID")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "GetByID", t.idNames())
+	}
+
+	if err := t.checkIDs(ids); err != nil {
+		return nil, err
 	}
-	if t.PostProcessRecord != nil {
-		if err := t.PostProcessRecord(record); err != nil {
-			return nil, fmt.Errorf("post process record error: %w", err)
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return nil, fmt.Errorf("query option error: %w", err)
 		}
 	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return nil, err
+	}
+
+	query := t.GetByIDQuery
+	if queryOptions.Lock != LockNone {
+		query += " " + queryOptions.Lock.clause(t.ref())
+	}
+	span.SetAttribute("db.statement", query)
+	var record = new(T)
+	err = db.GetContext(ctx, record, query, ids...)
+	if err != nil {
+		return nil, wrapQueryError(ctx, err)
+	}
+	if err := t.postProcessOpts(ctx, record, queryOptions); err != nil {
+		return nil, err
+	}
+	rows = 1
 	return record, nil
 }
 
-// DeleteByID deletes a single record by ID(s)
-func (t *Table[T]) DeleteByID(ctx context.Context, db DB, ids ...interface{}) error {
+// GetByIDs fetches the records with any of the IDs using a single query. Records are
+// returned in no particular order and missing IDs are skipped. Only tables with a
+// single ID field are supported, an error is returned otherwise.
+func (t *Table[T]) GetByIDs(ctx context.Context, db DB, ids ...interface{}) (_ []*T, err error) {
+	var rows int64
+	if Observer != nil {
+		defer t.observe("GetByIDs", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "GetByIDs")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "GetByIDs", nil)
+	}
+
+	query, err := t.GenerateGetByIDsQuery()
+	if err != nil {
+		return nil, &store.Error{Type: store.ErrorTypeQuery, Err: err}
+	}
+	span.SetAttribute("db.statement", query)
+	var records = make([]*T, 0, len(ids))
+	if len(ids) == 0 {
+		return records, nil
+	}
+	err = db.SelectContext(ctx, &records, query, pq.Array(ids))
+	if err != nil {
+		return nil, wrapQueryError(ctx, err)
+	}
+	for _, record := range records {
+		if err := t.postProcess(ctx, record); err != nil {
+			return nil, err
+		}
+	}
+	rows = int64(len(records))
+	return records, nil
+}
+
+// DeleteByIDs deletes the records with any of the IDs using a single query and returns
+// the number of records deleted. Missing IDs are skipped. If the table has a
+// SoftDeleteColumn the records are marked deleted instead. Only tables with a single
+// ID field are supported, an error is returned otherwise.
+func (t *Table[T]) DeleteByIDs(ctx context.Context, db DB, ids ...interface{}) (rows int64, err error) {
+	if Observer != nil {
+		defer t.observe("DeleteByIDs", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "DeleteByIDs")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "DeleteByIDs", nil)
+	}
+
+	query, err := t.GenerateDeleteByIDsQuery()
+	if err != nil {
+		return 0, &store.Error{Type: store.ErrorTypeQuery, Err: err}
+	}
+	span.SetAttribute("db.statement", query)
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result, err := db.ExecContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return 0, wrapQueryError(ctx, err)
+	}
+	rows, err = result.RowsAffected()
+	if err != nil {
+		return 0, wrapQueryError(ctx, err)
+	}
+	return rows, nil
+}
+
+// DeleteByID deletes a single record by ID(s). If the table has a SoftDeleteColumn
+// the record is marked deleted instead. The ids are provided in the same order as
+// GetByID.
+func (t *Table[T]) DeleteByID(ctx context.Context, db DB, ids ...interface{}) (err error) {
+	var rows int64
+	if Observer != nil {
+		defer t.observe("DeleteByID", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "DeleteByID")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "DeleteByID", t.idNames())
+	}
+
+	if err := t.checkIDs(ids); err != nil {
+		return err
+	}
+	span.SetAttribute("db.statement", t.DeleteByIDQuery)
 	result, err := db.ExecContext(ctx, t.DeleteByIDQuery, ids...)
 	if err != nil {
-		return WrapError(err)
+		return wrapQueryError(ctx, err)
 	}
-	rowsAffected, err := result.RowsAffected()
+	rows, err = result.RowsAffected()
 	if err != nil {
-		return WrapError(err)
+		return wrapQueryError(ctx, err)
 	}
-	if rowsAffected == 0 {
+	if rows == 0 {
 		return store.ErrNotFound
 	}
 	return nil
 }
 
+// DeleteByIDIfExists deletes a single record by ID(s) like DeleteByID. It returns
+// false without an error if there is no record with the ID(s).
+func (t *Table[T]) DeleteByIDIfExists(ctx context.Context, db DB, ids ...interface{}) (bool, error) {
+	err := t.DeleteByID(ctx, db, ids...)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteByQuery deletes all records matching whereClause and returns the number of
+// records deleted. If the table has a SoftDeleteColumn the records are marked deleted
+// instead. The whereClause is required, use TRUE to delete every record.
+func (t *Table[T]) DeleteByQuery(ctx context.Context, db DB, whereClause string, args ...interface{}) (rows int64, err error) {
+	if Observer != nil {
+		defer t.observe("DeleteByQuery", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "DeleteByQuery")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "DeleteByQuery", nil)
+	}
+
+	if whereClause == "" {
+		return 0, &store.Error{Type: store.ErrorTypeQuery, Err: errors.New("delete by query requires a where clause")}
+	}
+	query := t.GenerateDeleteWhereQuery(whereClause)
+	span.SetAttribute("db.statement", query)
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, wrapQueryError(ctx, err)
+	}
+	rows, err = result.RowsAffected()
+	if err != nil {
+		return 0, wrapQueryError(ctx, err)
+	}
+	return rows, nil
+}
+
+// InsertSelect copies the rows of fromTable matching whereClause into the table and
+// returns the number of records inserted. The fields with an Insert are copied from
+// the columns with the same name in fromTable, for example to archive records. If
+// whereClause is empty every row is copied.
+func (t *Table[T]) InsertSelect(ctx context.Context, db DB, fromTable string, whereClause string, args ...interface{}) (rows int64, err error) {
+	if Observer != nil {
+		defer t.observe("InsertSelect", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "InsertSelect")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "InsertSelect", nil)
+	}
+
+	if fromTable == "" {
+		return 0, &store.Error{Type: store.ErrorTypeQuery, Err: errors.New("insert select requires a table to select from")}
+	}
+	query := t.GenerateInsertSelectQuery(fromTable, whereClause)
+	span.SetAttribute("db.statement", query)
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, wrapQueryError(ctx, err)
+	}
+	rows, err = result.RowsAffected()
+	if err != nil {
+		return 0, wrapQueryError(ctx, err)
+	}
+	return rows, nil
+}
+
+// UpdateByQuery sets the fields in set on all records matching whereClause and returns
+// the number of records updated. The keys of set must be field names, each value is
+// checked by the Validate of its field and bound with its Update expression. The
+// whereClause references args as $1..$n and is required, use TRUE to update every
+// record. If the table has a VersionColumn it is incremented on every record updated,
+// so a concurrent Update of one of them returns store.ErrConcurrentModification.
+func (t *Table[T]) UpdateByQuery(ctx context.Context, db DB, set map[string]any, whereClause string, args ...interface{}) (rows int64, err error) {
+	if Observer != nil {
+		defer t.observe("UpdateByQuery", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "UpdateByQuery")
+	defer func() { span.End(err) }()
+
+	if whereClause == "" {
+		return 0, &store.Error{Type: store.ErrorTypeQuery, Err: errors.New("update by query requires a where clause")}
+	}
+
+	// Sort the fields so the generated query is stable.
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	query, err := t.GenerateUpdateWhereQuery(whereClause, len(args), names...)
+	if err != nil {
+		return 0, &store.Error{Type: store.ErrorTypeQuery, Err: err}
+	}
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "UpdateByQuery", append(make([]string, len(args)), names...))
+	}
+
+	queryArgs := append([]any{}, args...)
+	fields, _ := t.lookupFields(names...)
+	for i, field := range fields {
+		if err := field.validate(set[names[i]]); err != nil {
+			return 0, err
+		}
+		queryArgs = append(queryArgs, set[names[i]])
+	}
+	span.SetAttribute("db.statement", query)
+	result, err := db.ExecContext(ctx, query, queryArgs...)
+	if err != nil {
+		return 0, wrapQueryError(ctx, err)
+	}
+	rows, err = result.RowsAffected()
+	if err != nil {
+		return 0, wrapQueryError(ctx, err)
+	}
+	return rows, nil
+}
+
 // Insert inserts a record
-func (t *Table[T]) Insert(ctx context.Context, db DB, record *T, opts ...QueryOption) error {
+func (t *Table[T]) Insert(ctx context.Context, db DB, record *T, opts ...QueryOption) (err error) {
+
+	var rows int64
+	if Observer != nil {
+		defer t.observe("Insert", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "Insert")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "Insert", t.argNames(writeInsert))
+	}
 
 	queryOptions := DefaultQueryOptions
-	for _, opt := range opts {
+	for _, opt := range t.options(opts) {
 		if err := opt(&queryOptions); err != nil {
 			return fmt.Errorf("query option error: %w", err)
 		}
 	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return err
+	}
 
-	var args []any
-	for _, field := range t.Fields {
-		if field.Value != nil {
-			arg, err := field.Value(record)
-			if err != nil {
-				return fmt.Errorf("could not get arg for field %s: %w", field.Name, err)
-			}
-			args = append(args, arg)
-		}
+	query, err := t.insertQuery(queryOptions)
+	if err != nil {
+		return err
+	}
+
+	span.SetAttribute("db.statement", query)
+	args, err := t.writeArgs(record, writeInsert, queryOptions.FieldValues)
+	if err != nil {
+		return err
+	}
+	into, dest, err := t.into(record, queryOptions)
+	if err != nil {
+		return err
 	}
 
 	if queryOptions.IgnoreReturn {
-		if _, err := db.ExecContext(ctx, t.InsertQuery, args...); err != nil {
-			return WrapError(err)
+		result, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return wrapQueryError(ctx, err)
+		}
+		if queryOptions.Result != nil {
+			*queryOptions.Result = result
 		}
 	} else {
-		err := db.GetContext(ctx, record, t.InsertQuery, args...)
+		err := db.GetContext(ctx, into, query, args...)
 		if err != nil {
-			return WrapError(err)
+			return wrapQueryError(ctx, err)
 		}
-		if t.PostProcessRecord != nil {
-			if err := t.PostProcessRecord(record); err != nil {
-				return fmt.Errorf("post process record error: %w", err)
-			}
+		if err := t.postProcessOpts(ctx, into, queryOptions); err != nil {
+			return err
+		}
+		if dest != nil {
+			*dest = into
 		}
 	}
+	rows = 1
 	return nil
 
 }
 
-// Updates a record using the Update query
-func (t *Table[T]) Update(ctx context.Context, db DB, record *T, opts ...QueryOption) error {
+// InsertBatch inserts multiple records using multi-row insert statements. The records
+// are split into as many statements as needed to stay under MaxParameters. Unless
+// IgnoreReturn is set, the returned rows are scanned back into records, matched by
+// their ID fields if the records bind them and in order otherwise, see matchReturned.
+func (t *Table[T]) InsertBatch(ctx context.Context, db DB, records []*T, opts ...QueryOption) (err error) {
+
+	var rows int64
+	if Observer != nil {
+		defer t.observe("InsertBatch", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "InsertBatch")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "InsertBatch", t.argNames(writeInsert))
+	}
 
 	queryOptions := DefaultQueryOptions
-	for _, opt := range opts {
+	for _, opt := range t.options(opts) {
 		if err := opt(&queryOptions); err != nil {
 			return fmt.Errorf("query option error: %w", err)
 		}
 	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return err
+	}
 
-	var args []any
-	for _, field := range t.Fields {
-		if field.Value != nil {
-			arg, err := field.Value(record)
-			if err != nil {
-				return fmt.Errorf("could not get arg for field %s: %w", field.Name, err)
-			}
-			args = append(args, arg)
+	if len(records) == 0 {
+		return nil
+	}
+
+	returning, err := t.lookupFields(queryOptions.Returning...)
+	if err != nil {
+		return fmt.Errorf("invalid returning fields: %w", err)
+	}
+
+	err = t.writeBatch(ctx, db, records, queryOptions, span, writeInsert, func(n int) string {
+		return t.generateInsertBatchQuery(n, returning)
+	}, nil)
+	if err != nil {
+		return err
+	}
+	rows = int64(len(records))
+	return nil
+
+}
+
+// InsertUnnest inserts multiple records in a single statement binding one array per
+// field, so it is not limited by MaxParameters like InsertBatch. Every field bound by
+// the Insert must have a PgType. Unless IgnoreReturn is set, the returned rows are
+// scanned back into records in order.
+func (t *Table[T]) InsertUnnest(ctx context.Context, db DB, records []*T, opts ...QueryOption) (err error) {
+
+	var rows int64
+	if Observer != nil {
+		defer t.observe("InsertUnnest", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "InsertUnnest")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "InsertUnnest", t.argNames(writeInsert))
+	}
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return fmt.Errorf("query option error: %w", err)
 		}
 	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return err
+	}
 
-	if queryOptions.IgnoreReturn {
-		if _, err := db.ExecContext(ctx, t.UpdateQuery, args...); err != nil {
-			return WrapError(err)
+	if len(records) == 0 {
+		return nil
+	}
+
+	returning, err := t.lookupFields(queryOptions.Returning...)
+	if err != nil {
+		return fmt.Errorf("invalid returning fields: %w", err)
+	}
+	query, err := t.generateInsertUnnestQuery(returning)
+	if err != nil {
+		return fmt.Errorf("could not generate insert query: %w", err)
+	}
+	span.SetAttribute("db.statement", query)
+
+	// Each field argument of the records is collected into the array of its column.
+	var columns [][]any
+	for _, record := range records {
+		recordArgs, err := t.writeArgs(record, writeInsert, queryOptions.FieldValues)
+		if err != nil {
+			return err
 		}
-	} else {
-		err := db.GetContext(ctx, record, t.UpdateQuery, args...)
+		if columns == nil {
+			columns = make([][]any, len(recordArgs))
+		}
+		for i, arg := range recordArgs {
+			columns[i] = append(columns[i], arg)
+		}
+	}
+	args := make([]any, len(columns))
+	for i, column := range columns {
+		args[i] = pq.Array(column)
+	}
+
+	if queryOptions.IgnoreReturn {
+		result, err := db.ExecContext(ctx, query, args...)
 		if err != nil {
-			return WrapError(err)
+			return wrapQueryError(ctx, err)
 		}
-		if t.PostProcessRecord != nil {
-			if err := t.PostProcessRecord(record); err != nil {
-				return fmt.Errorf("post process record error: %w", err)
-			}
+		if queryOptions.Result != nil {
+			*queryOptions.Result = result
+		}
+		rows = int64(len(records))
+		return nil
+	}
+
+	var returned []*T
+	if err := db.SelectContext(ctx, &returned, query, args...); err != nil {
+		return wrapQueryError(ctx, err)
+	}
+	if len(returned) != len(records) {
+		return fmt.Errorf("insert returned %d records, expected %d", len(returned), len(records))
+	}
+	for i, record := range returned {
+		if err := t.postProcessOpts(ctx, record, queryOptions); err != nil {
+			return err
 		}
+		*records[i] = *record
 	}
+	rows = int64(len(records))
 	return nil
 
 }
 
-// Upsert a record using the Upsert query.
-func (t *Table[T]) Upsert(ctx context.Context, db DB, record *T, opts ...QueryOption) error {
+// UpsertBatch upserts multiple records using multi-row upsert statements. The records
+// are split into as many statements as needed to stay under MaxParameters. Unless
+// IgnoreReturn is set, the returned rows are scanned back into records, matched by
+// their ConflictColumns or ID fields if the records bind them, see matchReturned. The
+// same record must not appear twice in a statement. With ConflictDoNothing, conflicting
+// rows are not returned and their records are left unchanged, which requires the rows
+// to be matched by key unless IgnoreReturn is set.
+func (t *Table[T]) UpsertBatch(ctx context.Context, db DB, records []*T, opts ...QueryOption) (err error) {
+
+	var rows int64
+	if Observer != nil {
+		defer t.observe("UpsertBatch", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "UpsertBatch")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "UpsertBatch", t.argNames(writeUpsertBatch))
+	}
 
 	queryOptions := DefaultQueryOptions
-	for _, opt := range opts {
+	for _, opt := range t.options(opts) {
 		if err := opt(&queryOptions); err != nil {
 			return fmt.Errorf("query option error: %w", err)
 		}
 	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return err
+	}
 
-	var args []any
+	if len(records) == 0 {
+		return nil
+	}
+	// Validate the options once, the query is generated per statement size.
+	if _, err := t.upsertQuery(writeUpsertBatch, 1, queryOptions); err != nil {
+		return err
+	}
+
+	err = t.writeBatch(ctx, db, records, queryOptions, span, writeUpsertBatch, func(n int) string {
+		query, _ := t.upsertQuery(writeUpsertBatch, n, queryOptions)
+		return query
+	}, nil)
+	if err != nil {
+		return err
+	}
+	rows = int64(len(records))
+	return nil
+
+}
+
+// UpsertBatchInserted upserts multiple records like UpsertBatch and reports for each
+// record whether it was inserted or updated on conflict. The returned rows are always
+// scanned back into records, only the table fields are returned so joined fields are
+// not set. ConflictDoNothing and IgnoreReturn are not supported.
+func (t *Table[T]) UpsertBatchInserted(ctx context.Context, db DB, records []*T, opts ...QueryOption) (_ []bool, err error) {
+
+	var rows int64
+	if Observer != nil {
+		defer t.observe("UpsertBatchInserted", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "UpsertBatchInserted")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "UpsertBatchInserted", t.argNames(writeUpsertBatch))
+	}
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return nil, fmt.Errorf("query option error: %w", err)
+		}
+	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return nil, err
+	}
+
+	if queryOptions.ConflictDoNothing || queryOptions.IgnoreReturn {
+		return nil, fmt.Errorf("upsert batch inserted does not support conflict do nothing or ignore return")
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	returning, conflict, err := t.upsertConflict(queryOptions)
+	if err != nil {
+		return nil, err
+	}
+	conflict.inserted = true
+
+	inserted := make([]bool, 0, len(records))
+	err = t.writeBatch(ctx, db, records, queryOptions, span, writeUpsertBatch, func(n int) string {
+		return t.generateUpsertBatchQuery(n, writeUpsertBatch, returning, conflict)
+	}, &inserted)
+	if err != nil {
+		return nil, err
+	}
+	rows = int64(len(records))
+	return inserted, nil
+
+}
+
+// upsertedRow is a row returned by UpsertBatchInserted.
+type upsertedRow[T any] struct {
+	Record   T    `db:"record"`
+	Inserted bool `db:"inserted"`
+}
+
+// writeBatch writes records in statements of at most MaxParameters arguments using
+// the query generated for each statement's row count. If inserted is set the rows
+// are scanned as upsertedRow and whether each was inserted is appended to it.
+func (t *Table[T]) writeBatch(ctx context.Context, db DB, records []*T, queryOptions QueryOptions, span Span, op writeOp, generate func(rows int) string, inserted *[]bool) error {
+
+	var argsPerRecord int
 	for _, field := range t.Fields {
-		if field.Value != nil {
-			arg, err := field.Value(record)
+		argsPerRecord += t.argCount(field, op)
+	}
+	batchSize := len(records)
+	if argsPerRecord > 0 && MaxParameters/argsPerRecord < batchSize {
+		batchSize = MaxParameters / argsPerRecord
+	}
+
+	var affected driver.RowsAffected
+	for start := 0; start < len(records); start += batchSize {
+		batch := records[start:min(start+batchSize, len(records))]
+
+		args := make([]any, 0, len(batch)*argsPerRecord)
+		for _, record := range batch {
+			recordArgs, err := t.writeArgs(record, op, queryOptions.FieldValues)
 			if err != nil {
-				return fmt.Errorf("could not get arg for field %s: %w", field.Name, err)
+				return err
 			}
-			args = append(args, arg)
+			args = append(args, recordArgs...)
 		}
-	}
 
-	if queryOptions.IgnoreReturn {
-		if _, err := db.ExecContext(ctx, t.UpsertQuery, args...); err != nil {
-			return WrapError(err)
+		query := generate(len(batch))
+		span.SetAttribute("db.statement", query)
+		if queryOptions.IgnoreReturn {
+			result, err := db.ExecContext(ctx, query, args...)
+			if err != nil {
+				return wrapQueryError(ctx, err)
+			}
+			if queryOptions.Result != nil {
+				rows, err := result.RowsAffected()
+				if err != nil {
+					return err
+				}
+				affected += driver.RowsAffected(rows)
+			}
+			continue
 		}
-	} else {
-		err := db.GetContext(ctx, record, t.UpsertQuery, args...)
+
+		var returned []*T
+		var upserted []upsertedRow[T]
+		if inserted != nil {
+			if err := db.SelectContext(ctx, &upserted, query, args...); err != nil {
+				return wrapQueryError(ctx, err)
+			}
+			for i := range upserted {
+				returned = append(returned, &upserted[i].Record)
+			}
+		} else if err := db.SelectContext(ctx, &returned, query, args...); err != nil {
+			return wrapQueryError(ctx, err)
+		}
+		matched, err := t.matchReturned(batch, returned, queryOptions, op)
 		if err != nil {
-			return WrapError(err)
+			return err
 		}
-		if t.PostProcessRecord != nil {
-			if err := t.PostProcessRecord(record); err != nil {
-				return fmt.Errorf("post process record error: %w", err)
+		batchInserted := make([]bool, len(batch))
+		for j, record := range returned {
+			if err := t.postProcessOpts(ctx, record, queryOptions); err != nil {
+				return err
+			}
+			*batch[matched[j]] = *record
+			if inserted != nil {
+				batchInserted[matched[j]] = upserted[j].Inserted
 			}
 		}
+		if inserted != nil {
+			*inserted = append(*inserted, batchInserted...)
+		}
+	}
+	// The statements are summed into a single result.
+	if queryOptions.IgnoreReturn && queryOptions.Result != nil {
+		*queryOptions.Result = affected
 	}
 	return nil
 
 }
 
-// GetByQuery fetches a single record by the given query and values
-func (t *Table[T]) GetByQuery(ctx context.Context, db DB, query string, values ...interface{}) (*T, error) {
-	var record = new(T)
-	err := db.GetContext(ctx, record, query, values...)
-	if err != nil {
-		return nil, WrapError(err)
+// matchReturned returns the index in batch of the record each returned row belongs
+// to. Rows are matched by the values of the key fields, the ConflictColumns of an
+// upsert or the ID fields, when every record in the batch binds a distinct key and
+// the key fields are returned, so rows returned in another order or skipped on
+// conflict are matched to their records. Otherwise a row must be returned for every
+// record, and they are matched in order. Tables with Joins must match by key, as
+// the order of the returned rows is not known.
+func (t *Table[T]) matchReturned(batch []*T, returned []*T, queryOptions QueryOptions, op writeOp) ([]int, error) {
+
+	if keyFields := t.batchKeyFields(queryOptions, op); len(keyFields) > 0 {
+		if matched, ok := matchByKey(keyFields, batch, returned); ok {
+			return matched, nil
+		}
+	}
+	if t.Joins != "" || len(t.StructuredJoins) > 0 {
+		return nil, fmt.Errorf("batch returned records that cannot be matched by key to the records of table %s with joins, use IgnoreReturn", t.Table)
+	}
+
+	if len(returned) != len(batch) {
+		return nil, fmt.Errorf("batch returned %d records, expected %d", len(returned), len(batch))
+	}
+	matched := make([]int, len(returned))
+	for j := range returned {
+		matched[j] = j
+	}
+	return matched, nil
+
+}
+
+// matchByKey matches the returned rows to the batch records with the same key. It
+// returns false if the records do not have distinct keys or a row matches none, for
+// example if the Insert of a key field transforms the value bound.
+func matchByKey[T any](keyFields []*Field[T], batch []*T, returned []*T) ([]int, bool) {
+
+	indexes := make(map[string]int, len(batch))
+	for i, record := range batch {
+		key, ok := batchKey(keyFields, record)
+		if _, duplicate := indexes[key]; !ok || duplicate {
+			return nil, false
+		}
+		indexes[key] = i
 	}
-	if t.PostProcessRecord != nil {
-		if err := t.PostProcessRecord(record); err != nil {
-			return nil, fmt.Errorf("post process record error: %w", err)
+	matched := make([]int, len(returned))
+	for j, record := range returned {
+		key, ok := batchKey(keyFields, record)
+		i, found := indexes[key]
+		if !ok || !found {
+			return nil, false
 		}
+		matched[j] = i
 	}
-	return record, nil
+	return matched, true
+
+}
+
+// batchKeyFields returns the fields matching the returned rows of a batch to its
+// records, or nil if they are not all bound and returned.
+func (t *Table[T]) batchKeyFields(queryOptions QueryOptions, op writeOp) []*Field[T] {
+
+	var keyFields []*Field[T]
+	if op == writeUpsertBatch && len(queryOptions.ConflictColumns) > 0 {
+		var err error
+		if keyFields, err = t.lookupFields(queryOptions.ConflictColumns...); err != nil {
+			return nil
+		}
+	} else {
+		for _, field := range t.Fields {
+			if field.ID {
+				keyFields = append(keyFields, field)
+			}
+		}
+	}
+	for _, field := range keyFields {
+		if field.Value == nil || t.argCount(field, op) != 1 || !t.scannable(field) {
+			return nil
+		}
+		if len(queryOptions.Returning) > 0 && !slices.ContainsFunc(queryOptions.Returning, func(name string) bool {
+			return strings.Trim(name, `"`) == strings.Trim(field.Name, `"`)
+		}) {
+			return nil
+		}
+	}
+	return keyFields
+
+}
+
+// batchKey returns the values of the key fields of the record as a string. The
+// values are converted to driver values first, so they compare the way they are
+// bound, and each is written with its type. It returns false if a value is NULL or
+// cannot be fetched or converted.
+func batchKey[T any](keyFields []*Field[T], record *T) (string, bool) {
+	var key strings.Builder
+	for _, field := range keyFields {
+		value, err := field.Value(record)
+		if err != nil {
+			return "", false
+		}
+		if value, err = driver.DefaultParameterConverter.ConvertValue(value); err != nil || value == nil {
+			return "", false
+		}
+		switch v := value.(type) {
+		case []byte:
+			value = string(v)
+		case time.Time:
+			value = v.UTC().Format(time.RFC3339Nano)
+		}
+		fmt.Fprintf(&key, "%T:%v\x00", value, value)
+	}
+	return key.String(), true
+}
+
+// Updates a record using the Update query
+func (t *Table[T]) Update(ctx context.Context, db DB, record *T, opts ...QueryOption) (err error) {
+
+	var rows int64
+	if Observer != nil {
+		defer t.observe("Update", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "Update")
+	defer func() { span.End(err) }()
+	conflictDB := db
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "Update", t.argNames(writeUpdate))
+	}
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return fmt.Errorf("query option error: %w", err)
+		}
+	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return err
+	}
+
+	query, err := t.updateQuery(queryOptions)
+	if err != nil {
+		return err
+	}
+
+	span.SetAttribute("db.statement", query)
+	args, err := t.writeArgs(record, writeUpdate, queryOptions.FieldValues)
+	if err != nil {
+		return err
+	}
+	into, dest, err := t.into(record, queryOptions)
+	if err != nil {
+		return err
+	}
+
+	if queryOptions.IgnoreReturn {
+		result, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return wrapQueryError(ctx, err)
+		}
+		if queryOptions.Result != nil {
+			*queryOptions.Result = result
+		}
+		if t.VersionColumn != "" || queryOptions.RequireRows {
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				return wrapQueryError(ctx, err)
+			}
+			if rowsAffected == 0 {
+				if t.VersionColumn != "" {
+					return t.versionConflict(ctx, conflictDB, record)
+				}
+				return store.ErrNotFound
+			}
+		}
+	} else {
+		err := db.GetContext(ctx, into, query, args...)
+		if err != nil {
+			err = wrapQueryError(ctx, err)
+			if t.VersionColumn != "" && errors.Is(err, store.ErrNotFound) {
+				return t.versionConflict(ctx, conflictDB, record)
+			}
+			return err
+		}
+		if err := t.postProcessOpts(ctx, into, queryOptions); err != nil {
+			return err
+		}
+		if dest != nil {
+			*dest = into
+		}
+	}
+	rows = 1
+	return nil
+
+}
+
+// UpdateResult holds a record before and after an update by UpdateReturningOld.
+type UpdateResult[T any] struct {
+	Old *T `db:"old"`
+	New *T `db:"new"`
+}
+
+// UpdateReturningOld updates a record like Update and returns the record before and
+// after the update, for example for audit logs. The record is also updated from the
+// new row. Only the table fields are returned so joined fields are not set, and the
+// Returning and IgnoreReturn options are not supported.
+func (t *Table[T]) UpdateReturningOld(ctx context.Context, db DB, record *T, opts ...QueryOption) (_ *UpdateResult[T], err error) {
+
+	var rows int64
+	if Observer != nil {
+		defer t.observe("UpdateReturningOld", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "UpdateReturningOld")
+	defer func() { span.End(err) }()
+	conflictDB := db
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "UpdateReturningOld", t.argNames(writeUpdate))
+	}
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return nil, fmt.Errorf("query option error: %w", err)
+		}
+	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return nil, err
+	}
+
+	if queryOptions.IgnoreReturn || len(queryOptions.Returning) > 0 {
+		return nil, fmt.Errorf("update returning old does not support ignore return or returning fields")
+	}
+	query, err := t.GenerateUpdateReturningOldQuery()
+	if err != nil {
+		return nil, fmt.Errorf("could not generate update query: %w", err)
+	}
+
+	span.SetAttribute("db.statement", query)
+	args, err := t.writeArgs(record, writeUpdate, queryOptions.FieldValues)
+	if err != nil {
+		return nil, err
+	}
+
+	var result UpdateResult[T]
+	if err := db.GetContext(ctx, &result, query, args...); err != nil {
+		err = wrapQueryError(ctx, err)
+		if t.VersionColumn != "" && errors.Is(err, store.ErrNotFound) {
+			return nil, t.versionConflict(ctx, conflictDB, record)
+		}
+		return nil, err
+	}
+	if err := t.postProcessOpts(ctx, result.Old, queryOptions); err != nil {
+		return nil, err
+	}
+	if err := t.postProcessOpts(ctx, result.New, queryOptions); err != nil {
+		return nil, err
+	}
+	*record = *result.New
+	rows = 1
+	return &result, nil
+
+}
+
+// UpdateN updates a record using the Update query and returns the number of rows
+// affected. The record is not updated from the returned row. Zero rows is not an
+// error unless RequireRows is set, then store.ErrNotFound is returned, or
+// store.ErrConcurrentModification if the VersionColumn did not match.
+func (t *Table[T]) UpdateN(ctx context.Context, db DB, record *T, opts ...QueryOption) (rows int64, err error) {
+
+	if Observer != nil {
+		defer t.observe("UpdateN", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "UpdateN")
+	defer func() { span.End(err) }()
+	conflictDB := db
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "UpdateN", t.argNames(writeUpdate))
+	}
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return 0, fmt.Errorf("query option error: %w", err)
+		}
+	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return 0, err
+	}
+
+	span.SetAttribute("db.statement", t.UpdateQuery)
+	args, err := t.writeArgs(record, writeUpdate, queryOptions.FieldValues)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := db.ExecContext(ctx, t.UpdateQuery, args...)
+	if err != nil {
+		return 0, wrapQueryError(ctx, err)
+	}
+	rows, err = result.RowsAffected()
+	if err != nil {
+		return 0, wrapQueryError(ctx, err)
+	}
+	if rows == 0 && queryOptions.RequireRows {
+		if t.VersionColumn != "" {
+			return 0, t.versionConflict(ctx, conflictDB, record)
+		}
+		return 0, store.ErrNotFound
+	}
+	return rows, nil
+
+}
+
+// UpdateFields updates only the named fields of a record by ID. Unknown field names
+// return an error. If the table has a VersionColumn the update only succeeds if the
+// version matches the record and increments it like Update.
+func (t *Table[T]) UpdateFields(ctx context.Context, db DB, record *T, fields ...string) error {
+	return t.UpdateFieldsWithOpts(ctx, db, record, fields)
+}
+
+// UpdateFieldsWithOpts updates only the named fields of a record like UpdateFields
+// with query options. Returning, IgnoreReturn, Result and RequireRows behave as they
+// do for Update.
+func (t *Table[T]) UpdateFieldsWithOpts(ctx context.Context, db DB, record *T, fields []string, opts ...QueryOption) (err error) {
+
+	var rows int64
+	if Observer != nil {
+		defer t.observe("UpdateFields", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "UpdateFields")
+	defer func() { span.End(err) }()
+	conflictDB := db
+	db = t.rebound(db)
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return fmt.Errorf("query option error: %w", err)
+		}
+	}
+
+	returning, err := t.lookupFields(queryOptions.Returning...)
+	if err != nil {
+		return fmt.Errorf("invalid returning fields: %w", err)
+	}
+	query, err := t.generateUpdateFieldsQuery(returning, fields...)
+	if err != nil {
+		return fmt.Errorf("could not generate update query: %w", err)
+	}
+	span.SetAttribute("db.statement", query)
+
+	if t.PreProcessRecord != nil {
+		if err := t.PreProcessRecord(record); err != nil {
+			return fmt.Errorf("pre process record error: %w", err)
+		}
+	}
+
+	// ID fields are bound first followed by the updated fields.
+	args, err := t.idArgs(record)
+	if err != nil {
+		return err
+	}
+	names := t.idNames()
+	updateFields, _ := t.lookupFields(fields...)
+	for _, field := range updateFields {
+		fieldArgs, err := t.args(field, record, writeUpdateFields)
+		if err != nil {
+			return err
+		}
+		args = append(args, fieldArgs...)
+		for range fieldArgs {
+			names = append(names, field.Name)
+		}
+	}
+	// The version is bound last, GenerateUpdateFieldsQuery checked it has a Value.
+	if versionField, _ := t.versionField(); versionField != nil {
+		versionArgs, err := t.args(versionField, record, writeUpdate)
+		if err != nil {
+			return err
+		}
+		args = append(args, versionArgs...)
+		names = append(names, versionField.Name)
+	}
+	if SlogLogger != nil {
+		db = t.logged(db, "UpdateFields", names)
+	}
+
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return err
+	}
+	into, dest, err := t.into(record, queryOptions)
+	if err != nil {
+		return err
+	}
+
+	if queryOptions.IgnoreReturn {
+		result, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return wrapQueryError(ctx, err)
+		}
+		if queryOptions.Result != nil {
+			*queryOptions.Result = result
+		}
+		if t.VersionColumn != "" || queryOptions.RequireRows {
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				return wrapQueryError(ctx, err)
+			}
+			if rowsAffected == 0 {
+				if t.VersionColumn != "" {
+					return t.versionConflict(ctx, conflictDB, record)
+				}
+				return store.ErrNotFound
+			}
+		}
+	} else {
+		err := db.GetContext(ctx, into, query, args...)
+		if err != nil {
+			err = wrapQueryError(ctx, err)
+			if t.VersionColumn != "" && errors.Is(err, store.ErrNotFound) {
+				return t.versionConflict(ctx, conflictDB, record)
+			}
+			return err
+		}
+		if err := t.postProcessOpts(ctx, into, queryOptions); err != nil {
+			return err
+		}
+		if dest != nil {
+			*dest = into
+		}
+	}
+	rows = 1
+	return nil
+
+}
+
+// versionConflict determines why a versioned update did not affect the record. The
+// db must be the one passed to the update, not rebound or logged, as Exists rebinds
+// and logs its own query.
+func (t *Table[T]) versionConflict(ctx context.Context, db DB, record *T) error {
+	ids, err := t.idArgs(record)
+	if err != nil {
+		return err
+	}
+	exists, err := t.Exists(ctx, db, ids...)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return store.ErrConcurrentModification
+	}
+	return store.ErrNotFound
+}
+
+// postProcess runs the field Scan functions and PostProcessRecordCtx or
+// PostProcessRecord on a record after it is read.
+func (t *Table[T]) postProcess(ctx context.Context, record *T) error {
+	postProcessRecord := postProcessRecordFunc(t.PostProcessRecordCtx, t.PostProcessRecord)
+	if err := t.postProcessWith(ctx, record, postProcessRecord); err != nil {
+		return fmt.Errorf("post process record error: %w", err)
+	}
+	return nil
+}
+
+// postProcessOpts is postProcess without the PostProcessRecord if SkipPostProcess is
+// set. The field Scan functions are always called.
+func (t *Table[T]) postProcessOpts(ctx context.Context, record *T, queryOptions QueryOptions) error {
+	if !queryOptions.SkipPostProcess {
+		return t.postProcess(ctx, record)
+	}
+	if err := t.postProcessWith(ctx, record, nil); err != nil {
+		return fmt.Errorf("post process record error: %w", err)
+	}
+	return nil
+}
+
+// postProcessWith runs the field Scan functions followed by postProcessRecord if it is set.
+func (t *Table[T]) postProcessWith(ctx context.Context, record *T, postProcessRecord func(context.Context, *T) error) error {
+	if t.UTC {
+		if v := reflect.ValueOf(record).Elem(); v.Kind() == reflect.Struct {
+			timesToUTC(v)
+		}
+	}
+	for _, field := range t.Fields {
+		if field.Scan != nil {
+			if err := field.Scan(record); err != nil {
+				return fmt.Errorf("could not scan field %s: %w", field.Name, err)
+			}
+		}
+		if err := field.checkAllowed(record); err != nil {
+			return err
+		}
+	}
+	if postProcessRecord != nil {
+		return postProcessRecord(ctx, record)
+	}
+	return nil
+}
+
+// checkAllowed returns an error if the field has AllowedValues and the value of
+// record is not one of them.
+func (f *Field[T]) checkAllowed(record *T) error {
+	if len(f.AllowedValues) == 0 || f.Value == nil {
+		return nil
+	}
+	value, err := f.Value(record)
+	if err != nil {
+		return fmt.Errorf("could not get value for field %s: %w", f.Name, err)
+	}
+	if valuer, ok := value.(driver.Valuer); ok {
+		if value, err = valuer.Value(); err != nil {
+			return fmt.Errorf("could not get value for field %s: %w", f.Name, err)
+		}
+	}
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		// Enum types are often defined as a string without a Valuer.
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.String {
+			return fmt.Errorf("field %s has allowed values but its value is %T, not a string", f.Name, value)
+		}
+		s = rv.String()
+	}
+	if !slices.Contains(f.AllowedValues, s) {
+		return fmt.Errorf("field %s has value %q which is not one of %s", f.Name, s, strings.Join(f.AllowedValues, ", "))
+	}
+	return nil
+}
+
+// postProcessRecordFunc returns withCtx if it is set, otherwise without adapted to
+// take a context. It returns nil if neither is set.
+func postProcessRecordFunc[T any](withCtx func(context.Context, *T) error, without func(*T) error) func(context.Context, *T) error {
+	if withCtx != nil {
+		return withCtx
+	}
+	if without != nil {
+		return func(_ context.Context, record *T) error {
+			return without(record)
+		}
+	}
+	return nil
+}
+
+// writeArgs runs PreProcessRecord and returns the values of the fields bound by
+// the insert, update or upsert. The fieldValues are used instead of the Value of the
+// named fields, which must each be bound to a single argument.
+func (t *Table[T]) writeArgs(record *T, op writeOp, fieldValues map[string]driver.Value) ([]any, error) {
+	if t.PreProcessRecord != nil {
+		if err := t.PreProcessRecord(record); err != nil {
+			return nil, fmt.Errorf("pre process record error: %w", err)
+		}
+	}
+	overrides := make(map[*Field[T]]driver.Value, len(fieldValues))
+	for name, value := range fieldValues {
+		fields, err := t.lookupFields(name)
+		if err != nil {
+			return nil, err
+		}
+		if t.argCount(fields[0], op) != 1 {
+			return nil, fmt.Errorf("field %s is not bound to a single argument in the query", name)
+		}
+		overrides[fields[0]] = value
+	}
+	var args []any
+	for _, field := range t.Fields {
+		if value, ok := overrides[field]; ok {
+			if err := field.validate(value); err != nil {
+				return nil, err
+			}
+			args = append(args, value)
+			continue
+		}
+		fieldArgs, err := t.args(field, record, op)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, fieldArgs...)
+	}
+	return args, nil
+}
+
+// args returns the positional arguments bound by the field in the statement for record.
+func (t *Table[T]) args(field *Field[T], record *T, op writeOp) ([]any, error) {
+	n := t.argCount(field, op)
+	if n == 0 {
+		return nil, nil
+	}
+	if field.Values != nil {
+		values, err := field.Values(record)
+		if err != nil {
+			return nil, fmt.Errorf("could not get args for field %s%s: %w", field.Name, t.recordIDs(record), err)
+		}
+		if len(values) != n {
+			return nil, fmt.Errorf("field %s returned %d values, expected %d", field.Name, len(values), n)
+		}
+		args := make([]any, len(values))
+		for i, value := range values {
+			if err := field.validate(value); err != nil {
+				return nil, err
+			}
+			args[i] = value
+		}
+		return args, nil
+	}
+	arg, err := field.Value(record)
+	if err != nil {
+		return nil, fmt.Errorf("could not get arg for field %s%s: %w", field.Name, t.recordIDs(record), err)
+	}
+	if err := field.validate(arg); err != nil {
+		return nil, err
+	}
+	return []any{arg}, nil
+}
+
+// recordIDs describes the ID field values of record for error messages, for example
+// " of record id=1". It is empty if there are no ID fields or their values cannot
+// be read.
+func (t *Table[T]) recordIDs(record *T) string {
+	var ids []string
+	for _, field := range t.Fields {
+		if !field.ID || field.Value == nil {
+			continue
+		}
+		value, err := field.Value(record)
+		if err != nil {
+			return ""
+		}
+		ids = append(ids, fmt.Sprintf("%s=%v", strings.Trim(field.Name, `"`), value))
+	}
+	if len(ids) == 0 {
+		return ""
+	}
+	return " of record " + strings.Join(ids, ",")
+}
+
+// validate runs the Validate function of the field on value if it is set.
+func (f *Field[T]) validate(value driver.Value) error {
+	if f.Validate == nil {
+		return nil
+	}
+	if err := f.Validate(value); err != nil {
+		return &store.Error{Type: store.ErrorTypeInvalid, Err: fmt.Errorf("invalid value for field %s: %w", f.Name, err)}
+	}
+	return nil
+}
+
+// into returns the record to scan the returned row into and, if IntoNew is set,
+// the destination to set to it once it has been scanned.
+func (t *Table[T]) into(record *T, queryOptions QueryOptions) (*T, **T, error) {
+	if queryOptions.IntoNew == nil {
+		return record, nil, nil
+	}
+	dest, ok := queryOptions.IntoNew.(**T)
+	if !ok || dest == nil {
+		return nil, nil, fmt.Errorf("into new requires a %T, got %T", dest, queryOptions.IntoNew)
+	}
+	return new(T), dest, nil
+}
+
+// options returns the DefaultOptions followed by opts.
+func (t *Table[T]) options(opts []QueryOption) []QueryOption {
+	if len(t.DefaultOptions) == 0 {
+		return opts
+	}
+	return append(slices.Clip(t.DefaultOptions), opts...)
+}
+
+// checkIDs returns a store.Error if the number of ids does not match the ID fields.
+// Tables without ID fields are not checked as they can only use custom queries.
+func (t *Table[T]) checkIDs(ids []interface{}) error {
+	var n int
+	for _, field := range t.Fields {
+		if field.ID {
+			n++
+		}
+	}
+	if n > 0 && len(ids) != n {
+		return &store.Error{Type: store.ErrorTypeQuery, Err: fmt.Errorf("expected %d ids for the ID fields %s, got %d", n, strings.Join(t.idNames(), ", "), len(ids))}
+	}
+	return nil
+}
+
+// idArgs returns the values of the ID fields of record.
+func (t *Table[T]) idArgs(record *T) ([]any, error) {
+	var args []any
+	for _, field := range t.Fields {
+		if field.ID {
+			if field.Value == nil {
+				return nil, fmt.Errorf("ID field %s has no Value function", field.Name)
+			}
+			arg, err := field.Value(record)
+			if err != nil {
+				return nil, fmt.Errorf("could not get arg for field %s: %w", field.Name, err)
+			}
+			args = append(args, arg)
+		}
+	}
+	return args, nil
+}
+
+// Upsert a record using the Upsert query.
+func (t *Table[T]) Upsert(ctx context.Context, db DB, record *T, opts ...QueryOption) (err error) {
+
+	var rows int64
+	if Observer != nil {
+		defer t.observe("Upsert", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "Upsert")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "Upsert", t.argNames(writeUpsert))
+	}
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return fmt.Errorf("query option error: %w", err)
+		}
+	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return err
+	}
+
+	query, err := t.upsertQuery(writeUpsert, 1, queryOptions)
+	if err != nil {
+		return err
+	}
+
+	span.SetAttribute("db.statement", query)
+	args, err := t.writeArgs(record, writeUpsert, queryOptions.FieldValues)
+	if err != nil {
+		return err
+	}
+	into, dest, err := t.into(record, queryOptions)
+	if err != nil {
+		return err
+	}
+
+	if queryOptions.IgnoreReturn {
+		result, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return wrapQueryError(ctx, err)
+		}
+		if queryOptions.Result != nil {
+			*queryOptions.Result = result
+		}
+		if queryOptions.RequireRows {
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				return wrapQueryError(ctx, err)
+			}
+			if rowsAffected == 0 {
+				return store.ErrNotFound
+			}
+		}
+	} else {
+		err := db.GetContext(ctx, into, query, args...)
+		if err != nil {
+			return wrapQueryError(ctx, err)
+		}
+		if err := t.postProcessOpts(ctx, into, queryOptions); err != nil {
+			return err
+		}
+		if dest != nil {
+			*dest = into
+		}
+	}
+	rows = 1
+	return nil
+
+}
+
+// FindOrCreate inserts the record unless a record with the same conflictCols, the ID
+// fields by default, exists, in which case that record is selected instead. The
+// record is updated from the inserted or existing row and created reports if it was
+// inserted. The insert uses ON CONFLICT DO NOTHING so a concurrent insert of the same
+// record is not an error, the winning record is returned. The conflict fields must
+// have a Value function. If the conflicting record is soft deleted ErrSoftDeleted is
+// returned, it is neither selected nor can it be inserted again.
+func (t *Table[T]) FindOrCreate(ctx context.Context, db DB, record *T, conflictCols ...string) (created bool, err error) {
+
+	var rows int64
+	if Observer != nil {
+		defer t.observe("FindOrCreate", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "FindOrCreate")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+
+	var conflict []*Field[T]
+	if len(conflictCols) > 0 {
+		if conflict, err = t.lookupFields(conflictCols...); err != nil {
+			return false, fmt.Errorf("invalid conflict columns: %w", err)
+		}
+	} else {
+		for _, field := range t.Fields {
+			if field.ID {
+				conflict = append(conflict, field)
+			}
+		}
+		if len(conflict) == 0 {
+			return false, ErrNoIDFields
+		}
+	}
+	var names []string
+	for _, field := range conflict {
+		if field.Value == nil {
+			return false, fmt.Errorf("conflict field %s has no Value function", field.Name)
+		}
+		names = append(names, field.Name)
+	}
+
+	// The insert and select bind different arguments, log each with its names so
+	// secret fields are redacted.
+	insertDB, selectDB := db, db
+	if SlogLogger != nil {
+		insertDB = t.logged(db, "FindOrCreate", t.argNames(writeUpsertBatch))
+		selectDB = t.logged(db, "FindOrCreate", names)
+	}
+
+	// Only the inserted fields are bound, nothing is updated on conflict.
+	insertQuery, err := t.upsertQuery(writeUpsertBatch, 1, QueryOptions{ConflictColumns: names, ConflictDoNothing: true})
+	if err != nil {
+		return false, err
+	}
+	insertArgs, err := t.writeArgs(record, writeUpsertBatch, nil)
+	if err != nil {
+		return false, err
+	}
+	selectQuery := t.GenerateGetByFieldsQuery(names...)
+	var selectArgs []any
+	for _, field := range conflict {
+		arg, err := field.Value(record)
+		if err != nil {
+			return false, fmt.Errorf("could not get arg for field %s: %w", field.Name, err)
+		}
+		selectArgs = append(selectArgs, arg)
+	}
+
+	// The existing record may be deleted between the insert and the select, or not
+	// visible to the select in a repeatable read transaction, try the insert again.
+	for attempt := 0; attempt < 2; attempt++ {
+		span.SetAttribute("db.statement", insertQuery)
+		err = insertDB.GetContext(ctx, record, insertQuery, insertArgs...)
+		if err == nil {
+			created = true
+			break
+		}
+		if err = wrapQueryError(ctx, err); !errors.Is(err, store.ErrNotFound) {
+			return false, err
+		}
+
+		span.SetAttribute("db.statement", selectQuery)
+		err = selectDB.GetContext(ctx, record, selectQuery, selectArgs...)
+		if err == nil {
+			break
+		}
+		if err = wrapQueryError(ctx, err); !errors.Is(err, store.ErrNotFound) {
+			return false, err
+		}
+		if t.SoftDeleteColumn != "" {
+			deletedQuery := t.generateSoftDeletedByFieldsQuery(names...)
+			span.SetAttribute("db.statement", deletedQuery)
+			var deleted bool
+			if err := selectDB.GetContext(ctx, &deleted, deletedQuery, selectArgs...); err != nil {
+				return false, wrapQueryError(ctx, err)
+			}
+			if deleted {
+				return false, ErrSoftDeleted
+			}
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := t.postProcess(ctx, record); err != nil {
+		return false, err
+	}
+	rows = 1
+	return created, nil
+
+}
+
+// UpsertN upserts a record using the Upsert query and returns the number of rows
+// affected, which is zero if ConflictDoNothing skipped the record. The record is not
+// updated from the returned row. Zero rows is not an error unless RequireRows is set,
+// then store.ErrNotFound is returned.
+func (t *Table[T]) UpsertN(ctx context.Context, db DB, record *T, opts ...QueryOption) (rows int64, err error) {
+
+	if Observer != nil {
+		defer t.observe("UpsertN", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "UpsertN")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "UpsertN", t.argNames(writeUpsert))
+	}
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return 0, fmt.Errorf("query option error: %w", err)
+		}
+	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return 0, err
+	}
+
+	query, err := t.upsertQuery(writeUpsert, 1, queryOptions)
+	if err != nil {
+		return 0, err
+	}
+
+	span.SetAttribute("db.statement", query)
+	args, err := t.writeArgs(record, writeUpsert, queryOptions.FieldValues)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, wrapQueryError(ctx, err)
+	}
+	rows, err = result.RowsAffected()
+	if err != nil {
+		return 0, wrapQueryError(ctx, err)
+	}
+	if rows == 0 && queryOptions.RequireRows {
+		return 0, store.ErrNotFound
+	}
+	return rows, nil
+
+}
+
+// insertQuery returns the insert query for the returning query option.
+func (t *Table[T]) insertQuery(queryOptions QueryOptions) (string, error) {
+	if len(queryOptions.Returning) == 0 {
+		return t.InsertQuery, nil
+	}
+	returning, err := t.lookupFields(queryOptions.Returning...)
+	if err != nil {
+		return "", fmt.Errorf("invalid returning fields: %w", err)
+	}
+	return t.generateInsertBatchQuery(1, returning), nil
+}
+
+// updateQuery returns the update query for the returning query option.
+func (t *Table[T]) updateQuery(queryOptions QueryOptions) (string, error) {
+	if len(queryOptions.Returning) == 0 {
+		return t.UpdateQuery, nil
+	}
+	returning, err := t.lookupFields(queryOptions.Returning...)
+	if err != nil {
+		return "", fmt.Errorf("invalid returning fields: %w", err)
+	}
+	return t.generateUpdateQuery(returning), nil
+}
+
+// upsertQuery returns the upsert or batch upsert query for rows records with the
+// returning and conflict query options. The Upsert query is used without options.
+func (t *Table[T]) upsertQuery(op writeOp, rows int, queryOptions QueryOptions) (string, error) {
+
+	if op == writeUpsert && len(queryOptions.Returning) == 0 && !queryOptions.hasConflict() {
+		return t.UpsertQuery, nil
+	}
+	returning, conflict, err := t.upsertConflict(queryOptions)
+	if err != nil {
+		return "", err
+	}
+	return t.generateUpsertBatchQuery(rows, op, returning, conflict), nil
+
+}
+
+// upsertConflict returns the returning fields and conflict handling of the options.
+func (t *Table[T]) upsertConflict(queryOptions QueryOptions) ([]*Field[T], upsertConflict, error) {
+
+	conflict := upsertConflict{where: queryOptions.ConflictWhere, doNothing: queryOptions.ConflictDoNothing}
+	returning, err := t.lookupFields(queryOptions.Returning...)
+	if err != nil {
+		return nil, conflict, fmt.Errorf("invalid returning fields: %w", err)
+	}
+	columns, err := t.lookupFields(queryOptions.ConflictColumns...)
+	if err != nil {
+		return nil, conflict, fmt.Errorf("invalid conflict columns: %w", err)
+	}
+	for _, field := range columns {
+		conflict.columns = append(conflict.columns, field.Name)
+	}
+	update, err := t.lookupFields(queryOptions.ConflictUpdate...)
+	if err != nil {
+		return nil, conflict, fmt.Errorf("invalid conflict update fields: %w", err)
+	}
+	for _, field := range update {
+		conflict.update = append(conflict.update, field.Name)
+	}
+	return returning, conflict, nil
+
+}
+
+// GetByQuery fetches a single record by the given query and values. It returns
+// store.ErrNotFound if the query returns no rows. If it returns more than one row
+// the first is used and the rest are discarded without an error, so the query
+// should be ordered and include LIMIT 1 to avoid reading rows that are not needed.
+func (t *Table[T]) GetByQuery(ctx context.Context, db DB, query string, values ...interface{}) (*T, error) {
+	return t.GetByQueryWithOpts(ctx, db, query, values)
+}
+
+// GetByQueryWithOpts fetches a single record by the given query and values like
+// GetByQuery with query options. A Lock is appended to the query.
+func (t *Table[T]) GetByQueryWithOpts(ctx context.Context, db DB, query string, values []interface{}, opts ...QueryOption) (_ *T, err error) {
+	var rows int64
+	if Observer != nil {
+		defer t.observe("GetByQuery", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "GetByQuery")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "GetByQuery", nil)
+	}
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return nil, fmt.Errorf("query option error: %w", err)
+		}
+	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return nil, err
+	}
+
+	if queryOptions.Lock != LockNone {
+		query += " " + queryOptions.Lock.clause("")
+	}
+	span.SetAttribute("db.statement", query)
+	var record = new(T)
+	err = db.GetContext(ctx, record, query, values...)
+	if err != nil {
+		return nil, wrapQueryError(ctx, err)
+	}
+	if err := t.postProcessOpts(ctx, record, queryOptions); err != nil {
+		return nil, err
+	}
+	rows = 1
+	return record, nil
+}
+
+// SelectByQuery fetches all records returned by the given query and values. It
+// returns an empty slice if there are no matches.
+func (t *Table[T]) SelectByQuery(ctx context.Context, db DB, query string, values ...interface{}) ([]*T, error) {
+	return t.SelectByQueryWithOpts(ctx, db, query, values)
+}
+
+// SelectByQueryWithOpts fetches all records returned by the given query and values
+// like SelectByQuery with query options.
+func (t *Table[T]) SelectByQueryWithOpts(ctx context.Context, db DB, query string, values []interface{}, opts ...QueryOption) (_ []*T, err error) {
+	var rows int64
+	if Observer != nil {
+		defer t.observe("SelectByQuery", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "SelectByQuery")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "SelectByQuery", nil)
+	}
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return nil, fmt.Errorf("query option error: %w", err)
+		}
+	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return nil, err
+	}
+
+	span.SetAttribute("db.statement", query)
+	var records = make([]*T, 0)
+	err = db.SelectContext(ctx, &records, query, values...)
+	if err != nil {
+		return nil, wrapQueryError(ctx, err)
+	}
+	for _, record := range records {
+		if err := t.postProcessOpts(ctx, record, queryOptions); err != nil {
+			return nil, err
+		}
+	}
+	rows = int64(len(records))
+	return records, nil
+}
+
+// SelectNamed fetches all records returned by a query with named parameters such as
+// :name, bound from the fields of the struct or the keys of the map arg like
+// sqlx.Named. It returns an empty slice if there are no matches.
+func (t *Table[T]) SelectNamed(ctx context.Context, db DB, query string, arg interface{}) ([]*T, error) {
+	return t.SelectNamedWithOpts(ctx, db, query, arg)
+}
+
+// SelectNamedWithOpts fetches all records returned by a query with named parameters
+// like SelectNamed with query options.
+func (t *Table[T]) SelectNamedWithOpts(ctx context.Context, db DB, query string, arg interface{}, opts ...QueryOption) ([]*T, error) {
+	query, args, err := sqlx.BindNamed(sqlx.DOLLAR, query, arg)
+	if err != nil {
+		return nil, &store.Error{Type: store.ErrorTypeQuery, Err: fmt.Errorf("could not bind named parameters: %w", err)}
+	}
+	return t.SelectByQueryWithOpts(ctx, db, query, args, opts...)
+}
+
+// Queryer is implemented by *sqlx.DB and *sqlx.Tx.
+type Queryer interface {
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+}
+
+// Iterate runs the query and returns the records one at a time instead of loading
+// them all into memory. The db must implement Queryer. The sequence can only be
+// ranged over once and must be ranged over to release the connection, the rows are
+// closed when the iteration ends, stops early or the context is cancelled. An error
+// ends the iteration.
+func (t *Table[T]) Iterate(ctx context.Context, db DB, query string, args ...interface{}) (iter.Seq2[*T, error], error) {
+	return t.IterateWithOpts(ctx, db, query, args)
+}
+
+// IterateWithOpts runs the query and returns the records one at a time like Iterate
+// with query options. A Timeout applies until the iteration ends, and so do the span,
+// Observer and log of the query, which report the records read.
+func (t *Table[T]) IterateWithOpts(ctx context.Context, db DB, query string, args []interface{}, opts ...QueryOption) (_ iter.Seq2[*T, error], err error) {
+
+	var rows int64
+	start := time.Now()
+	ctx, span := t.startSpan(ctx, "Iterate")
+	span.SetAttribute("db.statement", query)
+	finish := func(err error) {
+		span.End(err)
+		if Observer != nil {
+			t.observe("Iterate", start, &rows, &err)
+		}
+		t.logQuery(ctx, "Iterate", query, args, start, rows, err)
+	}
+	defer func() {
+		if err != nil {
+			finish(err)
+		}
+	}()
+
+	queryer, ok := db.(Queryer)
+	if !ok {
+		return nil, &store.Error{Type: store.ErrorTypeQuery, Err: fmt.Errorf("db %T does not implement Queryer", db)}
+	}
+	boundQuery, boundArgs, err := Rebind(t.BindType, query, args)
+	if err != nil {
+		return nil, err
+	}
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return nil, fmt.Errorf("query option error: %w", err)
+		}
+	}
+	ctx, cancel := queryOptions.context(ctx)
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		cancel()
+		return nil, err
+	}
+	result, err := queryer.QueryxContext(ctx, boundQuery, boundArgs...)
+	if err != nil {
+		cancel()
+		return nil, wrapQueryError(ctx, err)
+	}
+	return func(yield func(*T, error) bool) {
+		var err error
+		defer func() { finish(err) }()
+		defer cancel()
+		defer result.Close()
+		for result.Next() {
+			var record = new(T)
+			if err = result.StructScan(record); err != nil {
+				err = wrapQueryError(ctx, err)
+				yield(nil, err)
+				return
+			}
+			if err = t.postProcessOpts(ctx, record, queryOptions); err != nil {
+				yield(nil, err)
+				return
+			}
+			rows++
+			if !yield(record, nil) {
+				return
+			}
+		}
+		if err = result.Err(); err != nil {
+			err = wrapQueryError(ctx, err)
+			yield(nil, err)
+		}
+	}, nil
+
+}
+
+// SelectMaps fetches the rows of any query as maps of column name to value, for
+// reads that do not map to T such as exports. The db must implement Queryer.
+// PostProcessRecord is not called.
+func (t *Table[T]) SelectMaps(ctx context.Context, db DB, query string, args ...interface{}) (_ []map[string]any, err error) {
+
+	var rows int64
+	if Observer != nil {
+		defer t.observe("SelectMaps", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "SelectMaps")
+	defer func() { span.End(err) }()
+	span.SetAttribute("db.statement", query)
+	defer func(start time.Time) { t.logQuery(ctx, "SelectMaps", query, args, start, rows, err) }(time.Now())
+
+	queryer, ok := db.(Queryer)
+	if !ok {
+		return nil, &store.Error{Type: store.ErrorTypeQuery, Err: fmt.Errorf("db %T does not implement Queryer", db)}
+	}
+	boundQuery, boundArgs, err := Rebind(t.BindType, query, args)
+	if err != nil {
+		return nil, err
+	}
+	result, err := queryer.QueryxContext(ctx, boundQuery, boundArgs...)
+	if err != nil {
+		return nil, wrapQueryError(ctx, err)
+	}
+	defer result.Close()
+
+	var records = make([]map[string]any, 0)
+	for result.Next() {
+		record := make(map[string]any)
+		if err := result.MapScan(record); err != nil {
+			return nil, wrapQueryError(ctx, err)
+		}
+		records = append(records, record)
+	}
+	if err := result.Err(); err != nil {
+		return nil, wrapQueryError(ctx, err)
+	}
+	rows = int64(len(records))
+	return records, nil
+
+}
+
+// Select fetches the records matching the query parameters using the Selector.
+// Only the declared Fields can be used for filtering and sorting.
+func (t *Table[T]) Select(ctx context.Context, db DB, qp QueryParams) ([]*T, error) {
+	return t.SelectWithOpts(ctx, db, qp)
+}
+
+// SelectWithOpts fetches the records matching the query parameters like Select with
+// query options.
+func (t *Table[T]) SelectWithOpts(ctx context.Context, db DB, qp QueryParams, opts ...QueryOption) (_ []*T, err error) {
+	var rows int64
+	if Observer != nil {
+		defer t.observe("Select", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "Select")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "Select", nil)
+	}
+
+	queryOptions := DefaultQueryOptions
+	for _, opt := range t.options(opts) {
+		if err := opt(&queryOptions); err != nil {
+			return nil, fmt.Errorf("query option error: %w", err)
+		}
+	}
+	ctx, cancel := queryOptions.context(ctx)
+	defer cancel()
+	if err := queryOptions.applySettings(ctx, db); err != nil {
+		return nil, err
+	}
+
+	s := t.selector(queryOptions)
+	records, err := s.Select(ctx, db, qp)
+	if err != nil {
+		return nil, err
+	}
+	rows = int64(len(records))
+	return records, nil
+}
+
+// SelectWhere fetches the records matching all the filters using the Selector. Each
+// key is a field name optionally followed by an operator, for example "age__gte". The
+// operators are eq, ne, lt, lte, gt, gte, like, ilike, in and nin, eq is used without one.
+// Unknown fields and operators return a store.Error.
+func (t *Table[T]) SelectWhere(ctx context.Context, db DB, filters map[string]any, opts ...SelectOption) ([]*T, error) {
+
+	var qp QueryParams
+	for _, opt := range opts {
+		if err := opt(&qp); err != nil {
+			return nil, fmt.Errorf("select option error: %w", err)
+		}
+	}
+
+	// Sort the keys so the generated query is stable.
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		field, op, err := parseFilterKey(key)
+		if err != nil {
+			return nil, &store.Error{Type: store.ErrorTypeQuery, Err: err}
+		}
+		qp.Filter = append(qp.Filter, Filter{Field: field, Op: op, Value: filters[key]})
+	}
+
+	return t.Select(ctx, db, qp)
+
+}
+
+// selector returns the table Selector with any unset values generated. The
+// PostProcessRecord is skipped if SkipPostProcess is set.
+func (t *Table[T]) selector(queryOptions QueryOptions) Selector[T] {
+	s := t.Selector
+	if s.Query == "" {
+		s.Query = t.GenerateSelectorQuery()
+	}
+	if s.Where == "" {
+		s.Where = t.GenerateSelectorWhere()
+	}
+	if s.Fields == nil {
+		s.Fields = t.GenerateSelectorFields()
+	}
+	postProcessRecord := postProcessRecordFunc(s.PostProcessRecordCtx, s.PostProcessRecord)
+	if postProcessRecord == nil {
+		postProcessRecord = postProcessRecordFunc(t.PostProcessRecordCtx, t.PostProcessRecord)
+	}
+	if queryOptions.SkipPostProcess {
+		postProcessRecord = nil
+	}
+	s.PostProcessRecord = nil
+	s.PostProcessRecordCtx = func(ctx context.Context, record *T) error {
+		return t.postProcessWith(ctx, record, postProcessRecord)
+	}
+	return s
+}
+
+// Exists checks if a record exists by ID(s). The ids are provided in the
+// same order as GetByID.
+func (t *Table[T]) Exists(ctx context.Context, db DB, ids ...interface{}) (_ bool, err error) {
+	var rows int64
+	if Observer != nil {
+		defer t.observe("Exists", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "Exists")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "Exists", t.idNames())
+	}
+
+	if err := t.checkIDs(ids); err != nil {
+		return false, err
+	}
+	query := t.GenerateExistsQuery()
+	span.SetAttribute("db.statement", query)
+	var exists bool
+	if err := db.GetContext(ctx, &exists, query, ids...); err != nil {
+		return false, wrapQueryError(ctx, err)
+	}
+	if exists {
+		rows = 1
+	}
+	return exists, nil
+}
+
+// Count returns the number of records matching the whereClause and args. If
+// whereClause is empty, all records in the table are counted. Soft deleted records
+// are not counted.
+func (t *Table[T]) Count(ctx context.Context, db DB, whereClause string, args ...interface{}) (count int64, err error) {
+	var rows int64
+	if Observer != nil {
+		defer t.observe("Count", time.Now(), &rows, &err)
+	}
+	ctx, span := t.startSpan(ctx, "Count")
+	defer func() { span.End(err) }()
+	db = t.rebound(db)
+	if SlogLogger != nil {
+		db = t.logged(db, "Count", nil)
+	}
+
+	query := t.GenerateCountQuery(whereClause)
+	span.SetAttribute("db.statement", query)
+	if err := db.GetContext(ctx, &count, query, args...); err != nil {
+		return 0, wrapQueryError(ctx, err)
+	}
+	rows = 1
+	return count, nil
+}
+
+// GetScalar fetches the single column of a single row result into V, for example a
+// status or an aggregate, without defining a struct for it. It returns
+// store.ErrNotFound if there are no rows. A NULL column requires a pointer or
+// sql.Null type for V.
+func GetScalar[V any](ctx context.Context, db DB, query string, args ...interface{}) (V, error) {
+	var value V
+	if err := db.GetContext(ctx, &value, query, args...); err != nil {
+		var zero V
+		return zero, wrapQueryError(ctx, err)
+	}
+	return value, nil
 }
@@ -0,0 +1,839 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evertonbiviatello/go-commons/store"
+	"github.com/evertonbiviatello/go-commons/store/driver/postgres"
+	"github.com/evertonbiviatello/go-commons/store/driver/postgres/pgtest"
+	"github.com/jackc/pgx/v5"
+)
+
+type user struct {
+	ID    int64  `db:"id" pk:"true"`
+	Email string `db:"email"`
+}
+
+func newUserTable(t *testing.T) *postgres.Table[user] {
+	t.Helper()
+	table := &postgres.Table[user]{Table: "users", Fields: postgres.FieldsFromStruct[user]()}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func TestGetNoRowsIsNotFound(t *testing.T) {
+	table := newUserTable(t)
+	db := pgtest.NewRecordingDB()
+	db.GetFunc = func(context.Context, interface{}, string, ...interface{}) error {
+		return sql.ErrNoRows
+	}
+	ctx := context.Background()
+
+	if _, err := table.GetByID(ctx, db, 1); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetByID error = %v, want store.ErrNotFound", err)
+	}
+	if _, err := table.GetByQuery(ctx, db, `SELECT * FROM users WHERE email = $1`, "a@b.c"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetByQuery error = %v, want store.ErrNotFound", err)
+	}
+	if got := len(db.Calls()); got != 2 {
+		t.Errorf("got %d calls, want 2", got)
+	}
+}
+
+type event struct {
+	ID        int64     `db:"id"`
+	Name      string    `db:"name"`
+	CreatedAt time.Time `db:"created_at"`
+	Kind      string    `db:"kind"`
+}
+
+func TestWriteArgsSkipLiteralFields(t *testing.T) {
+	table := &postgres.Table[event]{Table: "events", Fields: []*postgres.Field[event]{
+		{Name: "id", ID: true, Select: true, Insert: postgres.Value,
+			Value: func(r *event) (driver.Value, error) { return r.ID, nil }},
+		// A literal expression binds no argument even though the field has a Value.
+		{Name: "created_at", Select: true, Insert: "now()", Update: "now()",
+			Value: func(r *event) (driver.Value, error) { return r.CreatedAt, nil }},
+		{Name: "name", Select: true, Insert: postgres.Value, Update: postgres.Value,
+			Value: func(r *event) (driver.Value, error) { return r.Name, nil }},
+		{Name: "kind", Select: true, Insert: "lower($#)", Update: "lower($#)",
+			Value: func(r *event) (driver.Value, error) { return r.Kind, nil }},
+	}}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	record := &event{ID: 7, Name: "launch", Kind: "Release"}
+	want := []interface{}{int64(7), "launch", "Release"}
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		write     func(db postgres.DB) error
+		wantQuery string
+	}{
+		{"Insert", func(db postgres.DB) error { return table.Insert(ctx, db, record) },
+			`INSERT INTO events (id,created_at,name,kind) VALUES($1,now(),$2,lower($3))`},
+		{"Update", func(db postgres.DB) error { return table.Update(ctx, db, record) },
+			`UPDATE events SET created_at = now(),name = $2,kind = lower($3) WHERE events.id = $1`},
+		{"Upsert", func(db postgres.DB) error { return table.Upsert(ctx, db, record) },
+			`ON CONFLICT (id) DO UPDATE SET created_at = now(),name = $2,kind = lower($3)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := pgtest.NewRecordingDB()
+			if err := tt.write(db); err != nil {
+				t.Fatal(err)
+			}
+			call, _ := db.LastCall()
+			if !strings.Contains(call.Query, tt.wantQuery) {
+				t.Errorf("query %q does not contain %q", call.Query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(call.Args, want) {
+				t.Errorf("args = %#v, want %#v", call.Args, want)
+			}
+		})
+	}
+}
+
+type membership struct {
+	GroupID int64  `db:"group_id" pk:"true"`
+	UserID  int64  `db:"user_id" pk:"true"`
+	Role    string `db:"role"`
+}
+
+func TestUpsertCompositeKeyConflict(t *testing.T) {
+	table := &postgres.Table[membership]{Table: "memberships", Fields: postgres.FieldsFromStruct[membership]()}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	want := ` ON CONFLICT (group_id,user_id) DO UPDATE SET role = $3 `
+	if !strings.Contains(table.UpsertQuery, want) {
+		t.Errorf("UpsertQuery %q does not contain %q", table.UpsertQuery, want)
+	}
+
+	db := pgtest.NewRecordingDB()
+	if err := table.Upsert(context.Background(), db, &membership{GroupID: 1, UserID: 2, Role: "owner"}); err != nil {
+		t.Fatal(err)
+	}
+	call, _ := db.LastCall()
+	if wantArgs := []interface{}{int64(1), int64(2), "owner"}; !reflect.DeepEqual(call.Args, wantArgs) {
+		t.Errorf("args = %#v, want %#v", call.Args, wantArgs)
+	}
+}
+
+type document struct {
+	ID    int64  `db:"id"`
+	Title string `db:"title"`
+}
+
+func TestUnmappedColumnsNotReturned(t *testing.T) {
+	table := &postgres.Table[document]{Table: "documents", Fields: []*postgres.Field[document]{
+		{Name: "id", ID: true, Select: true, Insert: postgres.Value,
+			Value: func(r *document) (driver.Value, error) { return r.ID, nil }},
+		{Name: "title", Select: true, Insert: postgres.Value, Update: postgres.Value,
+			Value: func(r *document) (driver.Value, error) { return r.Title, nil }},
+		// updated_at is set by the database and has no field in the struct.
+		{Name: "updated_at", Select: true, Insert: "now()", Update: "now()"},
+	}}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "documents.id,documents.title"; table.SelectFields != want {
+		t.Errorf("SelectFields = %q, want %q", table.SelectFields, want)
+	}
+	for name, query := range map[string]string{"InsertQuery": table.InsertQuery, "UpdateQuery": table.UpdateQuery, "UpsertQuery": table.UpsertQuery} {
+		if want := ") SELECT documents.id,documents.title FROM documents"; !strings.HasSuffix(query, want) {
+			t.Errorf("%s %q does not end with %q", name, query, want)
+		}
+	}
+	if want := "updated_at = now()"; !strings.Contains(table.UpdateQuery, want) {
+		t.Errorf("UpdateQuery %q does not contain %q", table.UpdateQuery, want)
+	}
+}
+
+type post struct {
+	ID          int64          `db:"id" pk:"true"`
+	UserID      int64          `db:"user_id"`
+	Title       string         `db:"title"`
+	AuthorEmail sql.NullString `db:"author_email"`
+}
+
+func TestSelectWithJoinQualifiesColumns(t *testing.T) {
+	table := &postgres.Table[post]{
+		Table:                  "posts",
+		Fields:                 postgres.FieldsFromStruct[post](),
+		Joins:                  "LEFT JOIN users ON users.id = posts.user_id",
+		SelectAdditionalFields: "users.email AS author_email",
+	}
+	// author_email is only read from the joined table.
+	table.Fields = table.Fields[:3]
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	want := "SELECT posts.id,posts.user_id,posts.title,users.email AS author_email FROM posts LEFT JOIN users ON users.id = posts.user_id WHERE posts.id = $1"
+	if table.GetByIDQuery != want {
+		t.Errorf("GetByIDQuery = %q, want %q", table.GetByIDQuery, want)
+	}
+
+	db := pgtest.NewRecordingDB()
+	qp := postgres.QueryParams{Filter: []postgres.Filter{{Field: "id", Op: postgres.FilterOpEquals, Value: 1}}}
+	if _, err := table.Select(context.Background(), db, qp); err != nil {
+		t.Fatal(err)
+	}
+	call, _ := db.LastCall()
+	if want := " LEFT JOIN users ON users.id = posts.user_id WHERE posts.id = $1"; !strings.HasSuffix(call.Query, want) {
+		t.Errorf("Select query %q does not end with %q", call.Query, want)
+	}
+}
+
+func TestUpsertPartialIndexConflict(t *testing.T) {
+	table := newUserTable(t)
+	opts := []postgres.QueryOption{
+		postgres.QueryOptionConflictColumns("email"),
+		postgres.QueryOptionConflictWhere("deleted_at IS NULL"),
+	}
+	ctx := context.Background()
+
+	db := pgtest.NewRecordingDB()
+	if err := table.Upsert(ctx, db, &user{ID: 1, Email: "a@b.c"}, opts...); err != nil {
+		t.Fatal(err)
+	}
+	call, _ := db.LastCall()
+	if want := " ON CONFLICT (email) WHERE deleted_at IS NULL DO UPDATE SET email = $2 "; !strings.Contains(call.Query, want) {
+		t.Errorf("Upsert query %q does not contain %q", call.Query, want)
+	}
+
+	db.Reset()
+	opts = append(opts, postgres.QueryOptionConflictDoNothing(true), postgres.QueryOptionIgnoreReturn(true))
+	if err := table.UpsertBatch(ctx, db, []*user{{ID: 1, Email: "a@b.c"}, {ID: 2, Email: "d@e.f"}}, opts...); err != nil {
+		t.Fatal(err)
+	}
+	call, _ = db.LastCall()
+	if want := " ON CONFLICT (email) WHERE deleted_at IS NULL DO NOTHING"; !strings.Contains(call.Query, want) {
+		t.Errorf("UpsertBatch query %q does not contain %q", call.Query, want)
+	}
+}
+
+type note struct {
+	ID       int64     `db:"id"`
+	Body     string    `db:"body"`
+	Modified time.Time `db:"modified"`
+}
+
+func TestFieldAlias(t *testing.T) {
+	table := &postgres.Table[note]{Table: "notes", Fields: []*postgres.Field[note]{
+		{Name: "id", ID: true, Select: true, Insert: postgres.Value,
+			Value: func(r *note) (driver.Value, error) { return r.ID, nil }},
+		{Name: "body", Select: true, Insert: postgres.Value, Update: postgres.Value,
+			Value: func(r *note) (driver.Value, error) { return r.Body, nil }},
+		{Name: "updated_at", Alias: "modified", Select: true, Insert: "now()", Update: "now()"},
+	}}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if want := `notes.id,notes.body,notes.updated_at AS "modified"`; table.SelectFields != want {
+		t.Errorf("SelectFields = %q, want %q", table.SelectFields, want)
+	}
+
+	db := pgtest.NewRecordingDB()
+	if err := table.Update(context.Background(), db, &note{ID: 1, Body: "b"}, postgres.QueryOptionReturning("updated_at")); err != nil {
+		t.Fatal(err)
+	}
+	call, _ := db.LastCall()
+	if want := ` RETURNING updated_at AS "modified"`; !strings.HasSuffix(call.Query, want) {
+		t.Errorf("Update query %q does not end with %q", call.Query, want)
+	}
+	if want := `) SELECT notes.id,notes.body,notes.updated_at AS "modified" FROM notes`; !strings.HasSuffix(table.InsertQuery, want) {
+		t.Errorf("InsertQuery %q does not end with %q", table.InsertQuery, want)
+	}
+}
+
+type counter struct {
+	ID    int64  `db:"id" pk:"true"`
+	Name  string `db:"name"`
+	Count int64  `db:"count" readonly:"true"`
+}
+
+func TestUpsertBatchMatchesReturnedRowsByKey(t *testing.T) {
+	table := &postgres.Table[counter]{Table: "counters", Fields: postgres.FieldsFromStruct[counter]()}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	returnRows := func(rows ...counter) func(context.Context, interface{}, string, ...interface{}) error {
+		return func(_ context.Context, dest interface{}, _ string, _ ...interface{}) error {
+			for i := range rows {
+				*dest.(*[]*counter) = append(*dest.(*[]*counter), &rows[i])
+			}
+			return nil
+		}
+	}
+	ctx := context.Background()
+
+	// The second record conflicts and is skipped, the others are returned out of order.
+	records := []*counter{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}, {ID: 3, Name: "c"}}
+	db := pgtest.NewRecordingDB()
+	db.SelectFunc = returnRows(counter{ID: 3, Name: "c", Count: 30}, counter{ID: 1, Name: "a", Count: 10})
+	if err := table.UpsertBatch(ctx, db, records, postgres.QueryOptionConflictDoNothing(true)); err != nil {
+		t.Fatal(err)
+	}
+	want := []counter{{ID: 1, Name: "a", Count: 10}, {ID: 2, Name: "b"}, {ID: 3, Name: "c", Count: 30}}
+	for i, record := range records {
+		if *record != want[i] {
+			t.Errorf("record %d = %+v, want %+v", i, *record, want[i])
+		}
+	}
+
+	// A row that matches no record cannot be matched in order with rows missing.
+	db.SelectFunc = returnRows(counter{ID: 4, Name: "d"})
+	if err := table.UpsertBatch(ctx, db, records, postgres.QueryOptionConflictDoNothing(true)); err == nil {
+		t.Error("UpsertBatch with an unmatched row returned no error")
+	}
+}
+
+type product struct {
+	ID       int64   `db:"id"`
+	Price    float64 `db:"price"`
+	TotalTax float64 `db:"total_tax"`
+}
+
+func TestGeneratedFieldNotWritten(t *testing.T) {
+	table := &postgres.Table[product]{Table: "products", Fields: []*postgres.Field[product]{
+		{Name: "id", ID: true, Select: true, Insert: postgres.Value,
+			Value: func(r *product) (driver.Value, error) { return r.ID, nil }},
+		{Name: "price", Select: true, Insert: postgres.Value, Update: postgres.Value,
+			Value: func(r *product) (driver.Value, error) { return r.Price, nil }},
+		// total_tax is GENERATED ALWAYS AS (price * 0.2) STORED.
+		{Name: "total_tax", Generated: true, Select: true, Insert: postgres.Value, Update: postgres.Value,
+			Value: func(r *product) (driver.Value, error) { return r.TotalTax, nil }},
+	}}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"InsertQuery", table.InsertQuery, "WITH products AS ( INSERT INTO products (id,price) VALUES($1,$2) RETURNING *) SELECT products.id,products.price,products.total_tax FROM products"},
+		{"UpdateQuery", table.UpdateQuery, "WITH products AS ( UPDATE products SET price = $2 WHERE products.id = $1 RETURNING *) SELECT products.id,products.price,products.total_tax FROM products"},
+		{"UpsertQuery", table.UpsertQuery, "WITH products AS ( INSERT INTO products (id,price) VALUES($1,$2) ON CONFLICT (id) DO UPDATE SET price = $2 RETURNING *) SELECT products.id,products.price,products.total_tax FROM products"},
+	}
+	for _, tt := range tests {
+		if tt.query != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.query, tt.want)
+		}
+	}
+
+	db := pgtest.NewRecordingDB()
+	ctx := context.Background()
+	if err := table.Insert(ctx, db, &product{ID: 1, Price: 10, TotalTax: 99}); err != nil {
+		t.Fatal(err)
+	}
+	call, _ := db.LastCall()
+	if want := []interface{}{int64(1), float64(10)}; !reflect.DeepEqual(call.Args, want) {
+		t.Errorf("Insert args = %#v, want %#v", call.Args, want)
+	}
+	if err := table.UpdateFields(ctx, db, &product{ID: 1}, "total_tax"); err == nil {
+		t.Error("UpdateFields of a generated field returned no error")
+	}
+}
+
+func TestCountExcludesSoftDeleted(t *testing.T) {
+	table := &postgres.Table[user]{Table: "users", Fields: postgres.FieldsFromStruct[user](), SoftDeleteColumn: "deleted_at"}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		where string
+		want  string
+	}{
+		{"", "SELECT COUNT(*) FROM users WHERE TRUE AND users.deleted_at IS NULL"},
+		{"email = $1 OR id = $2", "SELECT COUNT(*) FROM users WHERE (email = $1 OR id = $2) AND users.deleted_at IS NULL"},
+	}
+	for _, tt := range tests {
+		db := pgtest.NewRecordingDB()
+		if _, err := table.Count(context.Background(), db, tt.where); err != nil {
+			t.Fatal(err)
+		}
+		call, _ := db.LastCall()
+		if call.Query != tt.want {
+			t.Errorf("Count(%q) query = %q, want %q", tt.where, call.Query, tt.want)
+		}
+	}
+}
+
+func TestSelectSkipPostProcess(t *testing.T) {
+	var processed int
+	table := newUserTable(t)
+	table.PostProcessRecord = func(*user) error {
+		processed++
+		return nil
+	}
+	db := pgtest.NewRecordingDB()
+	db.SelectFunc = func(_ context.Context, dest interface{}, _ string, _ ...interface{}) error {
+		*dest.(*[]*user) = append(*dest.(*[]*user), &user{ID: 1})
+		return nil
+	}
+	ctx := context.Background()
+	skip := postgres.QueryOptionSkipPostProcess(true)
+
+	selects := map[string]func(opts ...postgres.QueryOption) error{
+		"SelectByQuery": func(opts ...postgres.QueryOption) error {
+			_, err := table.SelectByQueryWithOpts(ctx, db, `SELECT * FROM users`, nil, opts...)
+			return err
+		},
+		"SelectNamed": func(opts ...postgres.QueryOption) error {
+			_, err := table.SelectNamedWithOpts(ctx, db, `SELECT * FROM users WHERE id = :id`, map[string]any{"id": 1}, opts...)
+			return err
+		},
+		"Select": func(opts ...postgres.QueryOption) error {
+			_, err := table.SelectWithOpts(ctx, db, postgres.QueryParams{}, opts...)
+			return err
+		},
+		"SelectPage": func(opts ...postgres.QueryOption) error {
+			_, _, err := table.SelectPageWithOpts(ctx, db, "", 10, nil, opts...)
+			return err
+		},
+	}
+	for name, selectRecords := range selects {
+		processed = 0
+		if err := selectRecords(skip); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if processed != 0 {
+			t.Errorf("%s with SkipPostProcess called PostProcessRecord %d times", name, processed)
+		}
+		if err := selectRecords(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if processed != 1 {
+			t.Errorf("%s called PostProcessRecord %d times, want 1", name, processed)
+		}
+	}
+}
+
+func TestUnboundValueRejected(t *testing.T) {
+	fields := func() []*postgres.Field[user] {
+		return []*postgres.Field[user]{
+			{Name: "id", ID: true, Select: true, Insert: postgres.Value,
+				Value: func(r *user) (driver.Value, error) { return r.ID, nil }},
+			{Name: "email", Select: true, Update: "lower($#)"},
+		}
+	}
+	table := &postgres.Table[user]{Table: "users", Fields: fields()}
+	if err := table.Init(); err == nil {
+		t.Error("Init of a field binding $# without a Value returned no error")
+	}
+
+	// A table that is not initialized is still checked when the query is generated.
+	table = &postgres.Table[user]{Table: "users", Fields: fields()}
+	if query, err := table.GenerateUpdateFieldsQuery("email"); err == nil {
+		t.Errorf("GenerateUpdateFieldsQuery = %q, want an error", query)
+	}
+}
+
+type article struct {
+	ID      int64  `db:"id" pk:"true"`
+	Title   string `db:"title"`
+	Version int64  `db:"version" readonly:"true"`
+}
+
+func newArticleTable(t *testing.T) *postgres.Table[article] {
+	t.Helper()
+	table := &postgres.Table[article]{Table: "articles", Fields: postgres.FieldsFromStruct[article](), VersionColumn: "version"}
+	for _, field := range table.Fields {
+		if field.Name == "version" {
+			field.Value = func(r *article) (driver.Value, error) { return r.Version, nil }
+		}
+	}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func TestVersionedPartialUpdates(t *testing.T) {
+	table := newArticleTable(t)
+	ctx := context.Background()
+
+	db := pgtest.NewRecordingDB()
+	db.GetFunc = func(_ context.Context, dest interface{}, _ string, _ ...interface{}) error {
+		if exists, ok := dest.(*bool); ok {
+			*exists = true
+			return nil
+		}
+		return sql.ErrNoRows
+	}
+	err := table.UpdateFields(ctx, db, &article{ID: 1, Title: "new", Version: 4}, "title")
+	if !errors.Is(err, store.ErrConcurrentModification) {
+		t.Errorf("UpdateFields with a stale version error = %v, want store.ErrConcurrentModification", err)
+	}
+	update := db.Calls()[0]
+	if want := "UPDATE articles SET title = $2,version = articles.version + 1 WHERE articles.id = $1 AND articles.version = $3 "; !strings.Contains(update.Query, want) {
+		t.Errorf("UpdateFields query %q does not contain %q", update.Query, want)
+	}
+	if want := []interface{}{int64(1), "new", int64(4)}; !reflect.DeepEqual(update.Args, want) {
+		t.Errorf("UpdateFields args = %#v, want %#v", update.Args, want)
+	}
+	if err := table.UpdateFields(ctx, db, &article{ID: 1}, "version"); err == nil {
+		t.Error("UpdateFields of the VersionColumn returned no error")
+	}
+
+	db = pgtest.NewRecordingDB()
+	if _, err := table.UpdateByQuery(ctx, db, map[string]any{"title": "archived"}, "id < $1", 10); err != nil {
+		t.Fatal(err)
+	}
+	call, _ := db.LastCall()
+	if want := "UPDATE articles SET title = $2,version = articles.version + 1 WHERE (id < $1)"; !strings.HasPrefix(call.Query, want) {
+		t.Errorf("UpdateByQuery query %q does not start with %q", call.Query, want)
+	}
+}
+
+func TestUpdatesExcludeSoftDeleted(t *testing.T) {
+	table := &postgres.Table[user]{Table: "users", Fields: postgres.FieldsFromStruct[user](), SoftDeleteColumn: "deleted_at"}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	fields, err := table.GenerateUpdateFieldsQuery("email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	returningOld, err := table.GenerateUpdateReturningOldQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries := map[string]string{
+		"GenerateUpdateQuery":             table.GenerateUpdateQuery(),
+		"GenerateUpdateFieldsQuery":       fields,
+		"GenerateUpdateReturningOldQuery": returningOld,
+	}
+	for name, query := range queries {
+		if want := "users.id = $1 AND users.deleted_at IS NULL"; !strings.Contains(query, want) {
+			t.Errorf("%s query %q does not contain %q", name, query, want)
+		}
+	}
+	if want := "WHERE users.id = $1 AND users.deleted_at IS NULL FOR UPDATE"; !strings.Contains(returningOld, want) {
+		t.Errorf("GenerateUpdateReturningOldQuery query %q does not lock with %q", returningOld, want)
+	}
+}
+
+func TestFindOrCreateSoftDeleted(t *testing.T) {
+	table := &postgres.Table[user]{Table: "users", Fields: postgres.FieldsFromStruct[user](), SoftDeleteColumn: "deleted_at"}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	db := pgtest.NewRecordingDB()
+	db.GetFunc = func(_ context.Context, dest interface{}, _ string, _ ...interface{}) error {
+		if deleted, ok := dest.(*bool); ok {
+			*deleted = true
+			return nil
+		}
+		return sql.ErrNoRows
+	}
+	created, err := table.FindOrCreate(context.Background(), db, &user{ID: 1, Email: "a@example.com"}, "email")
+	if !errors.Is(err, postgres.ErrSoftDeleted) || created {
+		t.Errorf("FindOrCreate = %v, %v, want false, postgres.ErrSoftDeleted", created, err)
+	}
+	call, _ := db.LastCall()
+	if want := "SELECT EXISTS(SELECT 1 FROM users WHERE users.email = $1 AND users.deleted_at IS NOT NULL)"; call.Query != want {
+		t.Errorf("soft deleted query = %q, want %q", call.Query, want)
+	}
+	if want := []interface{}{"a@example.com"}; !reflect.DeepEqual(call.Args, want) {
+		t.Errorf("soft deleted args = %#v, want %#v", call.Args, want)
+	}
+}
+
+func TestLogRedactsUnnamedArgs(t *testing.T) {
+	var logs strings.Builder
+	postgres.SlogLogger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	defer func() { postgres.SlogLogger, postgres.LogUnnamedArgs = nil, false }()
+
+	table := newUserTable(t)
+	db := pgtest.NewRecordingDB()
+	ctx := context.Background()
+	if _, err := table.SelectByQuery(ctx, db, `SELECT * FROM users WHERE reset_token = $1`, []any{"s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(logs.String(), "s3cret") {
+		t.Errorf("log %q contains an unnamed argument", logs.String())
+	}
+
+	logs.Reset()
+	postgres.LogUnnamedArgs = true
+	if _, err := table.SelectByQuery(ctx, db, `SELECT * FROM users WHERE email = $1`, []any{"a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "a@example.com") {
+		t.Errorf("log %q does not contain the argument with LogUnnamedArgs", logs.String())
+	}
+}
+
+func TestVersionConflictLoggedOnce(t *testing.T) {
+	var logs strings.Builder
+	postgres.SlogLogger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	defer func() { postgres.SlogLogger = nil }()
+
+	table := newArticleTable(t)
+	db := pgtest.NewRecordingDB()
+	db.GetFunc = func(_ context.Context, dest interface{}, _ string, _ ...interface{}) error {
+		if exists, ok := dest.(*bool); ok {
+			*exists = true
+			return nil
+		}
+		return sql.ErrNoRows
+	}
+	err := table.Update(context.Background(), db, &article{ID: 1, Title: "new", Version: 4})
+	if !errors.Is(err, store.ErrConcurrentModification) {
+		t.Fatalf("Update error = %v, want store.ErrConcurrentModification", err)
+	}
+	if got := strings.Count(logs.String(), "op=Update "); got != 1 {
+		t.Errorf("logged %d statements for Update, want only the update:\n%s", got, logs.String())
+	}
+	if got := strings.Count(logs.String(), "op=Exists "); got != 1 {
+		t.Errorf("logged %d statements for Exists, want 1:\n%s", got, logs.String())
+	}
+}
+
+func TestBatchResultSumsStatements(t *testing.T) {
+	table := newUserTable(t)
+	db := pgtest.NewRecordingDB()
+	db.ExecFunc = func(_ context.Context, _ string, args ...interface{}) (sql.Result, error) {
+		return driver.RowsAffected(len(args) / 2), nil
+	}
+	records := make([]*user, postgres.MaxParameters)
+	for i := range records {
+		records[i] = &user{ID: int64(i + 1)}
+	}
+	ctx := context.Background()
+
+	var result sql.Result
+	if err := table.InsertBatch(ctx, db, records, postgres.QueryOptionIgnoreReturn(true), postgres.QueryOptionResult(&result)); err != nil {
+		t.Fatal(err)
+	}
+	if calls := len(db.Calls()); calls != 3 {
+		t.Fatalf("InsertBatch ran %d statements, want 3", calls)
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows != int64(len(records)) {
+		t.Errorf("InsertBatch RowsAffected = %d, %v, want %d", rows, err, len(records))
+	}
+
+	result = nil
+	if err := table.UpsertBatch(ctx, db, records[:2], postgres.QueryOptionIgnoreReturn(true), postgres.QueryOptionResult(&result)); err != nil {
+		t.Fatal(err)
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows != 2 {
+		t.Errorf("UpsertBatch RowsAffected = %d, %v, want 2", rows, err)
+	}
+}
+
+func TestUpdateFieldsWithOpts(t *testing.T) {
+	table := newUserTable(t)
+	db := pgtest.NewRecordingDB()
+	ctx := context.Background()
+
+	if err := table.UpdateFieldsWithOpts(ctx, db, &user{ID: 1, Email: "a@example.com"}, []string{"email"}, postgres.QueryOptionReturning("id")); err != nil {
+		t.Fatal(err)
+	}
+	call, _ := db.LastCall()
+	if want := "UPDATE users SET email = $2 WHERE users.id = $1 RETURNING id"; call.Method != pgtest.MethodGet || !strings.HasPrefix(call.Query, want) {
+		t.Errorf("UpdateFieldsWithOpts Returning call = %s %q, want a get of %q", call.Method, call.Query, want)
+	}
+
+	var result sql.Result
+	err := table.UpdateFieldsWithOpts(ctx, db, &user{ID: 1}, []string{"email"},
+		postgres.QueryOptionIgnoreReturn(true), postgres.QueryOptionRequireRows(true), postgres.QueryOptionResult(&result))
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdateFieldsWithOpts RequireRows error = %v, want store.ErrNotFound", err)
+	}
+	if call, _ := db.LastCall(); call.Method != pgtest.MethodExec || result == nil {
+		t.Errorf("UpdateFieldsWithOpts IgnoreReturn call = %s, result %v, want an exec setting the result", call.Method, result)
+	}
+
+	db.GetFunc = func(ctx context.Context, _ interface{}, _ string, _ ...interface{}) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("UpdateFieldsWithOpts Timeout did not set a deadline")
+		}
+		return nil
+	}
+	if err := table.UpdateFieldsWithOpts(ctx, db, &user{ID: 1}, []string{"email"}, postgres.QueryOptionTimeout(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelectPageInstrumented(t *testing.T) {
+	var observed []string
+	postgres.Observer = func(op string, table string, _ time.Duration, rows int64, err error) {
+		observed = append(observed, fmt.Sprintf("%s %s %d %v", op, table, rows, err))
+	}
+	var logs strings.Builder
+	postgres.SlogLogger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	defer func() { postgres.Observer, postgres.SlogLogger = nil, nil }()
+
+	table := newUserTable(t)
+	db := pgtest.NewRecordingDB()
+	db.SelectFunc = func(_ context.Context, dest interface{}, _ string, _ ...interface{}) error {
+		*dest.(*[]*user) = append(*dest.(*[]*user), &user{ID: 1}, &user{ID: 2})
+		return nil
+	}
+	if _, _, err := table.SelectPage(context.Background(), db, "", 10); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"SelectPage users 2 <nil>"}; !reflect.DeepEqual(observed, want) {
+		t.Errorf("observed %q, want %q", observed, want)
+	}
+	if !strings.Contains(logs.String(), "op=SelectPage") {
+		t.Errorf("log %q does not report the query", logs.String())
+	}
+}
+
+func TestSelectPagedSortsByID(t *testing.T) {
+	table := newUserTable(t)
+	tests := []struct {
+		qp   postgres.QueryParams
+		want string
+	}{
+		{postgres.QueryParams{}, "FROM users"},
+		{postgres.QueryParams{Limit: 10}, "FROM users ORDER BY users.id ASC LIMIT 10"},
+		{postgres.QueryParams{Offset: 20}, "FROM users ORDER BY users.id ASC OFFSET 20"},
+		{postgres.QueryParams{Limit: 10, Sort: []postgres.OrderBy{{Field: "email"}}}, "FROM users ORDER BY users.email ASC,users.id ASC LIMIT 10"},
+	}
+	for _, tt := range tests {
+		db := pgtest.NewRecordingDB()
+		if _, err := table.Select(context.Background(), db, tt.qp); err != nil {
+			t.Fatal(err)
+		}
+		call, _ := db.LastCall()
+		if !strings.HasSuffix(call.Query, tt.want) {
+			t.Errorf("Select(%+v) query %q does not end with %q", tt.qp, call.Query, tt.want)
+		}
+	}
+}
+
+type meeting struct {
+	At   time.Time `db:"at" pk:"true"`
+	Name string    `db:"name"`
+}
+
+func TestInsertBatchMatchesConvertedKeys(t *testing.T) {
+	table := &postgres.Table[meeting]{Table: "meetings", Fields: postgres.FieldsFromStruct[meeting]()}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	first := time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	second := first.Add(time.Hour)
+	db := pgtest.NewRecordingDB()
+	db.SelectFunc = func(_ context.Context, dest interface{}, _ string, _ ...interface{}) error {
+		// The rows are returned in UTC and in reverse order.
+		*dest.(*[]*meeting) = []*meeting{{At: second.UTC(), Name: "second returned"}, {At: first.UTC(), Name: "first returned"}}
+		return nil
+	}
+	records := []*meeting{{At: first, Name: "first"}, {At: second, Name: "second"}}
+	if err := table.InsertBatch(context.Background(), db, records); err != nil {
+		t.Fatal(err)
+	}
+	if records[0].Name != "first returned" || records[1].Name != "second returned" {
+		t.Errorf("InsertBatch matched %q, %q, want the rows with the same instant", records[0].Name, records[1].Name)
+	}
+
+	table = &postgres.Table[meeting]{Table: "meetings", Fields: postgres.FieldsFromStruct[meeting](), Joins: "JOIN calendars ON calendars.id = meetings.calendar_id"}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	db.SelectFunc = func(_ context.Context, dest interface{}, _ string, _ ...interface{}) error {
+		*dest.(*[]*meeting) = []*meeting{{At: second.Add(time.Minute)}, {At: first.Add(time.Minute)}}
+		return nil
+	}
+	if err := table.InsertBatch(context.Background(), db, records); err == nil {
+		t.Error("InsertBatch matched unknown keys in order for a table with joins")
+	}
+}
+
+type copyConn struct {
+	tableName pgx.Identifier
+	columns   []string
+}
+
+func (c *copyConn) CopyFrom(_ context.Context, tableName pgx.Identifier, columns []string, rows pgx.CopyFromSource) (int64, error) {
+	c.tableName, c.columns = tableName, columns
+	var n int64
+	for rows.Next() {
+		n++
+	}
+	return n, rows.Err()
+}
+
+func TestCopyFromNormalisesIdentifiers(t *testing.T) {
+	type account struct {
+		ID    int64  `db:"ID" pk:"true"`
+		Label string `db:"\"Label\""`
+	}
+	table := &postgres.Table[account]{Schema: `"Tenant"`, Table: "Accounts", Fields: postgres.FieldsFromStruct[account]()}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	conn := &copyConn{}
+	if _, err := table.CopyFrom(context.Background(), conn, []*account{{ID: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := (pgx.Identifier{"Tenant", "accounts"}); !reflect.DeepEqual(conn.tableName, want) {
+		t.Errorf("CopyFrom table = %q, want %q", conn.tableName, want)
+	}
+	if want := []string{"id", "Label"}; !reflect.DeepEqual(conn.columns, want) {
+		t.Errorf("CopyFrom columns = %q, want %q", conn.columns, want)
+	}
+}
+
+func TestUpdateByQueryAppliesFieldRules(t *testing.T) {
+	email := &postgres.Field[user]{Name: "email", Select: true, Insert: postgres.Value, Update: "lower(" + postgres.Value + ")", Cast: "citext",
+		Value: func(r *user) (driver.Value, error) { return r.Email, nil },
+		Validate: func(v driver.Value) error {
+			if v == "" {
+				return errors.New("empty")
+			}
+			return nil
+		},
+	}
+	touched := &postgres.Field[user]{Name: "touched_at", Select: true, Update: "now()"}
+	id := &postgres.Field[user]{Name: "id", ID: true, Select: true, Insert: postgres.Value, Value: func(r *user) (driver.Value, error) { return r.ID, nil }}
+	table := &postgres.Table[user]{Table: "users", Fields: []*postgres.Field[user]{id, email, touched}}
+	if err := table.Init(); err != nil {
+		t.Fatal(err)
+	}
+	db := pgtest.NewRecordingDB()
+	ctx := context.Background()
+
+	if _, err := table.UpdateByQuery(ctx, db, map[string]any{"email": "A@example.com"}, "id = $1", 1); err != nil {
+		t.Fatal(err)
+	}
+	call, _ := db.LastCall()
+	if want := "UPDATE users SET email = lower($2::citext) WHERE (id = $1)"; call.Query != want {
+		t.Errorf("UpdateByQuery query = %q, want %q", call.Query, want)
+	}
+
+	var storeErr *store.Error
+	if _, err := table.UpdateByQuery(ctx, db, map[string]any{"email": ""}, "id = $1", 1); !errors.As(err, &storeErr) || storeErr.Type != store.ErrorTypeInvalid {
+		t.Errorf("UpdateByQuery of an invalid value error = %v, want a store.ErrorTypeInvalid", err)
+	}
+	if _, err := table.UpdateByQuery(ctx, db, map[string]any{"touched_at": time.Now()}, "id = $1", 1); err == nil {
+		t.Error("UpdateByQuery of a field whose Update binds no value returned no error")
+	}
+}
+
+func TestInitRejectsUnboundID(t *testing.T) {
+	id := &postgres.Field[user]{Name: "id", ID: true, Select: true}
+	table := &postgres.Table[user]{Table: "users", Fields: []*postgres.Field[user]{id}}
+	if err := table.Init(); err == nil {
+		t.Error("Init with an ID field without a Value returned no error")
+	}
+}
@@ -3,10 +3,12 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
-
-	"github.com/spf13/cast"
 )
 
 type DB interface {
@@ -15,7 +17,105 @@ type DB interface {
 	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 }
 
+// ErrNoIDFields is returned when a query requiring ID fields is generated for a table without any.
+var ErrNoIDFields = errors.New("no ID fields")
+
+// ErrSoftDeleted is returned by FindOrCreate when the conflicting record is soft deleted.
+var ErrSoftDeleted = errors.New("record is soft deleted")
+
+// Generate returns a copy of the table with any queries that were not specified generated.
 func Generate[T any](t Table[T]) *Table[T] {
+	t.generate()
+	return &t
+}
+
+// WithSchema returns a copy of the table using schema, for example to select a tenant
+// schema at request time. Queries that were generated from the table are regenerated
+// for the schema, queries that were specified are kept as is.
+func (t *Table[T]) WithSchema(schema string) *Table[T] {
+
+	current, target := t.regenerated(t.Schema), t.regenerated(schema)
+	clone := *t
+	clone.Schema = schema
+	for _, q := range []struct{ query, current, target *string }{
+		{&clone.GetByIDQuery, &current.GetByIDQuery, &target.GetByIDQuery},
+		{&clone.DeleteByIDQuery, &current.DeleteByIDQuery, &target.DeleteByIDQuery},
+		{&clone.InsertQuery, &current.InsertQuery, &target.InsertQuery},
+		{&clone.UpdateQuery, &current.UpdateQuery, &target.UpdateQuery},
+		{&clone.UpsertQuery, &current.UpsertQuery, &target.UpsertQuery},
+		{&clone.Selector.Query, &current.Selector.Query, &target.Selector.Query},
+	} {
+		if *q.query == *q.current {
+			*q.query = *q.target
+		}
+	}
+	return &clone
+
+}
+
+// regenerated returns a copy of the table with all queries generated for schema.
+func (t *Table[T]) regenerated(schema string) Table[T] {
+	c := *t
+	c.Schema = schema
+	c.GetByIDQuery, c.DeleteByIDQuery, c.InsertQuery, c.UpdateQuery, c.UpsertQuery = "", "", "", "", ""
+	c.Selector.Query = ""
+	c.generate()
+	return c
+}
+
+// Init generates any queries on the table that were not specified from the Schema,
+// Table and Fields. It returns ErrNoIDFields if the GetByID, DeleteByID, Update
+// or Upsert queries need to be generated but no Field has ID set, and an error if
+// a Field has a NullVal that cannot be rendered by Literal or a field constructor
+// such as JSONField or EncryptedField was given an unusable record type or key. ID
+// fields must have a Value function.
+func (t *Table[T]) Init() error {
+	if t.Table == "" {
+		return errors.New("no table name specified")
+	}
+	var hasID bool
+	for _, field := range t.Fields {
+		if field.ID {
+			hasID = true
+			break
+		}
+	}
+	if !hasID {
+		for _, q := range []struct{ name, query string }{
+			{"GetByIDQuery", t.GetByIDQuery},
+			{"DeleteByIDQuery", t.DeleteByIDQuery},
+			{"UpdateQuery", t.UpdateQuery},
+			{"UpsertQuery", t.UpsertQuery},
+		} {
+			if q.query == "" {
+				return fmt.Errorf("could not generate %s for table %s: %w", q.name, t.Table, ErrNoIDFields)
+			}
+		}
+	}
+	for _, field := range t.Fields {
+		if field.err != nil {
+			return field.err
+		}
+		if field.ID && field.Value == nil {
+			// The ID predicates bind a single argument per ID field, so Values cannot
+			// be used either.
+			return fmt.Errorf("ID field %s has no Value function", field.Name)
+		}
+		if field.NullVal != nil {
+			if _, err := Literal(field.NullVal); err != nil {
+				return fmt.Errorf("invalid NullVal for field %s: %w", field.Name, err)
+			}
+		}
+		if err := field.checkBound(); err != nil {
+			return err
+		}
+	}
+	t.generate()
+	return nil
+}
+
+// generate fills in any queries that were not specified.
+func (t *Table[T]) generate() {
 
 	if t.SelectFields == "" {
 		t.SelectFields = t.GenerateSelectFields()
@@ -35,28 +135,125 @@ func Generate[T any](t Table[T]) *Table[T] {
 	if t.UpsertQuery == "" {
 		t.UpsertQuery = t.GenerateUpsertQuery()
 	}
-	//if t.Selector.Query == "" {
-	//	t.Selector.Query = t.GenerateSelectorQuery()
-	//}
+	if t.Selector.Query == "" {
+		t.Selector.Query = t.GenerateSelectorQuery()
+	}
+	if t.Selector.Where == "" {
+		t.Selector.Where = t.GenerateSelectorWhere()
+	}
+	if t.Selector.Fields == nil {
+		t.Selector.Fields = t.GenerateSelectorFields()
+	}
+	if t.Selector.IDs == nil {
+		t.Selector.IDs = t.GenerateSelectorIDs()
+	}
 
-	return &t
 }
 
+// GenerateSelectFields generates the comma separated select fields of the table.
+// Each field is qualified with the Alias or table name so it is not ambiguous with
+// the columns of any Joins. Fields that do not map to the record struct are left
+// out, see scannable.
 func (t *Table[T]) GenerateSelectFields() string {
 
 	var b strings.Builder
-	for i, field := range t.Fields {
-		if i > 0 {
+	for _, field := range t.Fields {
+		if !t.scannable(field) {
+			continue
+		}
+		if b.Len() > 0 {
 			b.WriteString(",")
 		}
-		b.WriteString(t.Table)
+		b.WriteString(t.ref())
 		b.WriteString(".")
 		b.WriteString(field.Name)
+		writeAlias(&b, field.Alias)
 	}
 	return b.String()
 
 }
 
+// scannable returns true if the field column maps to a field of the record struct
+// using the `db` tag or the lower case field name, so it can be selected. Fields
+// without one, such as server generated columns, are left out of the generated
+// select and returned fields.
+func (t *Table[T]) scannable(field *Field[T]) bool {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if isScalar(typ) {
+		return true
+	}
+	_, ok := structFieldMap(typ)[field.scanName()]
+	return ok
+}
+
+// scanName returns the name the field is scanned as, its Alias or unquoted Name.
+func (f *Field[T]) scanName() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return strings.Trim(f.Name, `"`)
+}
+
+// returnedName returns the name of the column returned by writeReturning, quoted if
+// it is the Alias.
+func (f *Field[T]) returnedName() string {
+	if f.Alias != "" {
+		return `"` + f.Alias + `"`
+	}
+	return f.Name
+}
+
+// placeholder returns the positional argument n of the field with its Cast.
+func (f *Field[T]) placeholder(n int) string {
+	if f.Cast != "" {
+		return "$" + strconv.Itoa(n) + "::" + f.Cast
+	}
+	return "$" + strconv.Itoa(n)
+}
+
+// insert returns the Insert of the field, or nothing if it is Generated.
+func (f *Field[T]) insert() string {
+	if f.Generated {
+		return ""
+	}
+	return f.Insert
+}
+
+// update returns the Update of the field, or nothing if it is Generated.
+func (f *Field[T]) update() string {
+	if f.Generated {
+		return ""
+	}
+	return f.Update
+}
+
+// checkBound returns an error if the Insert or Update of the field binds a positional
+// argument but the field has no Value or Values function to bind, which would leave
+// the Value constant in the query.
+func (f *Field[T]) checkBound() error {
+	if f.Value != nil || f.Values != nil {
+		return nil
+	}
+	if strings.Contains(f.insert(), Value) || strings.Contains(f.update(), Value) {
+		return fmt.Errorf("field %s binds %s but has no Value or Values", f.Name, Value)
+	}
+	return nil
+}
+
+// writeAlias writes the AS clause of a selected column if alias is set.
+func writeAlias(b *strings.Builder, alias string) {
+	if alias != "" {
+		b.WriteString(` AS "`)
+		b.WriteString(alias)
+		b.WriteString(`"`)
+	}
+}
+
+// GenerateAdditionalFields generates the select fields for this table to be used in
+// the SelectAdditionalFields of another table that joins it. Each field is aliased
+// as "table.field" so it can be scanned into a nested struct. If coalesce is true,
+// fields with a NullVal are wrapped in COALESCE(field, NullVal) for left joins. The
+// NullVal is rendered with Literal, a field with an unsupported NullVal is not wrapped.
 func (t *Table[T]) GenerateAdditionalFields(coalesce bool) string {
 
 	var b strings.Builder
@@ -64,32 +261,26 @@ func (t *Table[T]) GenerateAdditionalFields(coalesce bool) string {
 		if i > 0 {
 			b.WriteString(",")
 		}
-		if coalesce {
+		var nullVal string
+		if coalesce && field.NullVal != nil {
+			// Unsupported values are reported by Init.
+			nullVal, _ = Literal(field.NullVal)
+		}
+		if nullVal != "" {
 			b.WriteString("COALESCE(")
 		}
-		b.WriteString(t.Table)
+		b.WriteString(t.ref())
 		b.WriteString(".")
 		b.WriteString(field.Name)
-		if coalesce {
+		if nullVal != "" {
 			b.WriteString(",")
-			switch v := field.NullVal.(type) {
-			case string:
-				b.WriteString("'")
-				b.WriteString(v)
-				b.WriteString("'")
-			case int, uint, int8, uint8, int16, uint16, int32, uint32, int64, uint64:
-				b.WriteString(cast.ToString(v))
-			default:
-				b.WriteString("'")
-				b.WriteString(cast.ToString(v))
-				b.WriteString("'")
-			}
+			b.WriteString(nullVal)
 			b.WriteString(")")
 		}
 		b.WriteString(" AS \"")
-		b.WriteString(strings.Trim(t.Table, `"`))
+		b.WriteString(strings.Trim(t.ref(), `"`))
 		b.WriteString(".")
-		b.WriteString(strings.Trim(field.Name, `"`))
+		b.WriteString(field.scanName())
 		b.WriteString("\"")
 	}
 	return b.String()
@@ -107,33 +298,73 @@ func (t *Table[T]) GenerateGetByIDQuery() string {
 		b.WriteString(t.SelectAdditionalFields)
 	}
 	b.WriteString(` FROM `)
-	if t.Schema != "" {
-		b.WriteString(t.Schema)
-		b.WriteByte('.')
+	t.writeTableName(&b)
+	t.writeJoins(&b)
+	b.WriteString(` WHERE `)
+
+	t.writeIDPredicate(&b)
+	t.writeSoftDeletePredicate(&b)
+	return b.String()
+
+}
+
+// GenerateGetByIDsQuery generates a query fetching the records whose ID is in the
+// array bound to $1. It only supports tables with a single ID field.
+func (t *Table[T]) GenerateGetByIDsQuery() (string, error) {
+
+	id, err := t.singleID()
+	if err != nil {
+		return "", err
 	}
-	b.WriteString(t.Table)
-	if t.Joins != "" {
-		b.WriteString(" ")
-		b.WriteString(t.Joins)
+
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	b.WriteString(t.SelectFields)
+	if t.SelectAdditionalFields != "" {
+		if t.SelectFields != "" {
+			b.WriteString(",")
+		}
+		b.WriteString(t.SelectAdditionalFields)
 	}
+	b.WriteString(` FROM `)
+	t.writeTableName(&b)
+	t.writeJoins(&b)
 	b.WriteString(` WHERE `)
+	b.WriteString(t.ref())
+	b.WriteString(".")
+	b.WriteString(id.Name)
+	b.WriteString(` = ANY($1)`)
+	t.writeSoftDeletePredicate(&b)
+	return b.String(), nil
 
-	var idIndex int
+}
+
+// GenerateDeleteByIDsQuery generates a query deleting the records whose ID is in the
+// array bound to $1, or marking them deleted if the table has a SoftDeleteColumn. It
+// only supports tables with a single ID field.
+func (t *Table[T]) GenerateDeleteByIDsQuery() (string, error) {
+	id, err := t.singleID()
+	if err != nil {
+		return "", err
+	}
+	return t.GenerateDeleteWhereQuery(t.ref() + "." + id.Name + " = ANY($1)"), nil
+}
+
+// singleID returns the ID field of a table with a single ID field.
+func (t *Table[T]) singleID() (*Field[T], error) {
+	var ids []*Field[T]
 	for _, field := range t.Fields {
 		if field.ID {
-			idIndex++
-			if idIndex > 1 {
-				b.WriteString(` AND `)
-			}
-			b.WriteString(t.Table)
-			b.WriteString(".")
-			b.WriteString(field.Name)
-			b.WriteString(" = $")
-			b.WriteString(strconv.Itoa(idIndex))
+			ids = append(ids, field)
 		}
 	}
-	return b.String()
-
+	switch {
+	case len(ids) == 0:
+		return nil, ErrNoIDFields
+	case len(ids) > 1:
+		return nil, fmt.Errorf("table %s has %d ID fields, only a single ID field is supported", t.Table, len(ids))
+	}
+	return ids[0], nil
 }
 
 func (t *Table[T]) GenerateGetByFieldsQuery(fields ...string) string {
@@ -148,15 +379,8 @@ func (t *Table[T]) GenerateGetByFieldsQuery(fields ...string) string {
 		b.WriteString(t.SelectAdditionalFields)
 	}
 	b.WriteString(` FROM `)
-	if t.Schema != "" {
-		b.WriteString(t.Schema)
-		b.WriteByte('.')
-	}
-	b.WriteString(t.Table)
-	if t.Joins != "" {
-		b.WriteString(" ")
-		b.WriteString(t.Joins)
-	}
+	t.writeTableName(&b)
+	t.writeJoins(&b)
 	b.WriteString(` WHERE `)
 
 	var idIndex int
@@ -165,12 +389,13 @@ func (t *Table[T]) GenerateGetByFieldsQuery(fields ...string) string {
 		if idIndex > 1 {
 			b.WriteString(` AND `)
 		}
-		b.WriteString(t.Table)
+		b.WriteString(t.ref())
 		b.WriteString(".")
 		b.WriteString(field)
 		b.WriteString(" = $")
 		b.WriteString(strconv.Itoa(idIndex))
 	}
+	t.writeSoftDeletePredicate(&b)
 	return b.String()
 
 }
@@ -178,186 +403,582 @@ func (t *Table[T]) GenerateGetByFieldsQuery(fields ...string) string {
 func (t *Table[T]) GenerateDeleteByIDQuery() string {
 
 	var b strings.Builder
-	b.WriteString(`DELETE FROM `)
-	if t.Schema != "" {
-		b.WriteString(t.Schema)
-		b.WriteByte('.')
+	if t.SoftDeleteColumn != "" {
+		b.WriteString(`UPDATE `)
+	} else {
+		b.WriteString(`DELETE FROM `)
+	}
+	t.writeTableName(&b)
+	if t.SoftDeleteColumn != "" {
+		b.WriteString(` SET `)
+		b.WriteString(t.SoftDeleteColumn)
+		b.WriteString(` = now()`)
 	}
-	b.WriteString(t.Table)
 	b.WriteString(` WHERE `)
+	t.writeIDPredicate(&b)
+	t.writeSoftDeletePredicate(&b)
+	return b.String()
 
-	var idIndex = 0
-	for _, field := range t.Fields {
-		if field.ID {
-			idIndex++
-			if idIndex > 1 {
-				b.WriteString(` AND `)
-			}
-			b.WriteString(t.Table)
-			b.WriteString(".")
-			b.WriteString(field.Name)
-			b.WriteString(" = $")
-			b.WriteString(strconv.Itoa(idIndex))
-		}
+}
+
+// GenerateDeleteWhereQuery generates a query deleting the records matching whereClause.
+// If the table has a SoftDeleteColumn the records are marked deleted instead.
+func (t *Table[T]) GenerateDeleteWhereQuery(whereClause string) string {
+
+	var b strings.Builder
+	if t.SoftDeleteColumn != "" {
+		b.WriteString(`UPDATE `)
+	} else {
+		b.WriteString(`DELETE FROM `)
 	}
+	t.writeTableName(&b)
+	if t.SoftDeleteColumn != "" {
+		b.WriteString(` SET `)
+		b.WriteString(t.SoftDeleteColumn)
+		b.WriteString(` = now()`)
+	}
+	b.WriteString(` WHERE (`)
+	b.WriteString(whereClause)
+	b.WriteString(`)`)
+	t.writeSoftDeletePredicate(&b)
 	return b.String()
 
 }
 
+// GenerateUpdateWhereQuery generates a query setting the named fields on the records
+// matching whereClause. The whereClause uses the first whereArgs positional arguments
+// and the field values are bound after them in the order provided, each with the
+// Update expression of the field if it has one, like Update. Fields whose Update
+// does not bind a value or that bind more than one cannot be set. Soft deleted
+// records are not updated.
+func (t *Table[T]) GenerateUpdateWhereQuery(whereClause string, whereArgs int, names ...string) (string, error) {
+
+	fields, err := t.lookupFields(names...)
+	if err != nil {
+		return "", err
+	}
+	if len(fields) == 0 {
+		return "", errors.New("no fields to update")
+	}
+
+	var b strings.Builder
+	b.WriteString(`UPDATE `)
+	t.writeTableName(&b)
+	b.WriteString(` SET `)
+	for i, field := range fields {
+		if field.Generated {
+			return "", fmt.Errorf("field %s is generated and cannot be updated", field.Name)
+		}
+		if t.VersionColumn != "" && field.Name == t.VersionColumn {
+			return "", fmt.Errorf("field %s is the VersionColumn and is incremented by the update", field.Name)
+		}
+		var update string
+		switch {
+		case field.Values != nil:
+			return "", fmt.Errorf("field %s binds more than one argument and cannot be set", field.Name)
+		case field.update() == "":
+			update = field.placeholder(whereArgs + i + 1)
+		case strings.Contains(field.update(), Value):
+			update = strings.ReplaceAll(field.update(), Value, field.placeholder(whereArgs+i+1))
+		default:
+			return "", fmt.Errorf("field %s does not bind a value in its Update and cannot be set", field.Name)
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(field.Name)
+		b.WriteString(" = ")
+		b.WriteString(update)
+	}
+	if t.VersionColumn != "" {
+		b.WriteString(",")
+		b.WriteString(t.versionIncrement())
+	}
+	b.WriteString(` WHERE (`)
+	b.WriteString(whereClause)
+	b.WriteString(`)`)
+	t.writeSoftDeletePredicate(&b)
+	return b.String(), nil
+
+}
+
 func (t *Table[T]) GenerateInsertQuery() string {
+	return t.GenerateInsertBatchQuery(1)
+}
+
+// GenerateInsertBatchQuery generates a multi-row insert query for the given number of rows.
+// Each row consumes one positional argument per field with an Insert and a Value function.
+func (t *Table[T]) GenerateInsertBatchQuery(rows int) string {
+	return t.generateInsertBatchQuery(rows, nil)
+}
+
+func (t *Table[T]) generateInsertBatchQuery(rows int, returning []*Field[T]) string {
 
 	var b strings.Builder
-	var names []string
-	var inserts []string
-	var argCount int
+	names, values := t.insertValues(rows, writeInsert)
+
+	t.writeReturningStart(&b, returning)
+	b.WriteString("INSERT INTO ")
+	t.writeTableName(&b)
+	b.WriteString(" (")
+	b.WriteString(strings.Join(names, ",")) // Fields
+	b.WriteString(") VALUES")
+	b.WriteString(strings.Join(values, ",")) // Inserts
+	t.writeReturning(&b, returning)
+	return b.String()
 
+}
+
+// GenerateInsertSelectQuery generates a query inserting the rows of fromTable matching
+// whereClause. The fields with an Insert are copied from the columns with the same
+// name in fromTable. If whereClause is empty every row is copied.
+func (t *Table[T]) GenerateInsertSelectQuery(fromTable string, whereClause string) string {
+
+	names, _ := t.insertValues(0, writeInsert)
+
+	var b strings.Builder
+	b.WriteString("INSERT INTO ")
+	t.writeTableName(&b)
+	b.WriteString(" (")
+	b.WriteString(strings.Join(names, ","))
+	b.WriteString(") SELECT ")
+	b.WriteString(strings.Join(names, ","))
+	b.WriteString(" FROM ")
+	b.WriteString(fromTable)
+	if whereClause != "" {
+		b.WriteString(" WHERE ")
+		b.WriteString(whereClause)
+	}
+	return b.String()
+
+}
+
+// GenerateInsertUnnestQuery generates an insert query taking one array argument per
+// field bound by the Insert. The rows are selected from unnest of the arrays, so any
+// number of records uses the same query and arguments. Every bound field must have a
+// PgType and bind a single argument.
+func (t *Table[T]) GenerateInsertUnnestQuery() (string, error) {
+	return t.generateInsertUnnestQuery(nil)
+}
+
+func (t *Table[T]) generateInsertUnnestQuery(returning []*Field[T]) (string, error) {
+
+	var names, inserts, arrays, columns []string
 	for _, field := range t.Fields {
-		index := "$#"
-		if field.Value != nil {
-			argCount++
-			index = "$" + strconv.Itoa(argCount)
+		if field.insert() == "" {
+			continue
 		}
-		if field.Insert != "" {
-			names = append(names, field.Name)
-			inserts = append(inserts, strings.ReplaceAll(field.Insert, Value, index))
+		names = append(names, field.Name)
+		switch t.argCount(field, writeInsert) {
+		case 0:
+			inserts = append(inserts, field.insert())
+			continue
+		case 1:
+		default:
+			return "", fmt.Errorf("field %s binds more than one argument, which unnest does not support", field.Name)
 		}
+		if field.PgType == "" {
+			return "", fmt.Errorf("field %s has no PgType", field.Name)
+		}
+		column := "c" + strconv.Itoa(len(arrays)+1)
+		arrays = append(arrays, "$"+strconv.Itoa(len(arrays)+1)+"::"+field.PgType+"[]")
+		columns = append(columns, column)
+		inserts = append(inserts, strings.ReplaceAll(field.insert(), Value, "unnested."+column))
 	}
-
-	b.WriteString("WITH ")
-	b.WriteString(t.Table)
-	b.WriteString(" AS ( INSERT INTO ")
-	if t.Schema != "" {
-		b.WriteString(t.Schema)
-		b.WriteString(".")
+	if len(arrays) == 0 {
+		return "", errors.New("no fields bind an argument to unnest")
 	}
-	b.WriteString(t.Table)
+
+	var b strings.Builder
+	t.writeReturningStart(&b, returning)
+	b.WriteString("INSERT INTO ")
+	t.writeTableName(&b)
 	b.WriteString(" (")
-	b.WriteString(strings.Join(names, ",")) // Fields
-	b.WriteString(") VALUES(")
-	b.WriteString(strings.Join(inserts, ",")) // Inserts
-	b.WriteString(") RETURNING *")
+	b.WriteString(strings.Join(names, ","))
 	b.WriteString(") SELECT ")
-	b.WriteString(t.SelectFields)
-	if t.SelectAdditionalFields != "" {
-		if t.SelectFields != "" {
-			b.WriteString(",")
+	b.WriteString(strings.Join(inserts, ","))
+	b.WriteString(" FROM unnest(")
+	b.WriteString(strings.Join(arrays, ","))
+	b.WriteString(") AS unnested(")
+	b.WriteString(strings.Join(columns, ","))
+	b.WriteString(")")
+	t.writeReturning(&b, returning)
+	return b.String(), nil
+
+}
+
+// insertValues returns the inserted field names and a VALUES row for each of rows.
+// Each row consumes the positional arguments of the fields bound by op.
+func (t *Table[T]) insertValues(rows int, op writeOp) (names []string, values []string) {
+
+	var argsPerRow int
+	for _, field := range t.Fields {
+		argsPerRow += t.argCount(field, op)
+		if field.insert() != "" {
+			names = append(names, field.Name)
 		}
-		b.WriteString(t.SelectAdditionalFields)
 	}
-	b.WriteString(" FROM ")
-	b.WriteString(t.Table)
-	if t.Joins != "" {
-		b.WriteString(" ")
-		b.WriteString(t.Joins)
+
+	for row := 0; row < rows; row++ {
+		var inserts []string
+		argCount := row * argsPerRow
+		for _, field := range t.Fields {
+			if field.insert() != "" {
+				inserts = append(inserts, field.bind(field.insert(), argCount))
+			}
+			argCount += t.argCount(field, op)
+		}
+		values = append(values, "("+strings.Join(inserts, ",")+")")
 	}
-	return b.String()
+	return names, values
 
 }
 
 func (t *Table[T]) GenerateUpdateQuery() string {
+	return t.generateUpdateQuery(nil)
+}
+
+func (t *Table[T]) generateUpdateQuery(returning []*Field[T]) string {
 
 	var b strings.Builder
 	var updates []string
 	var argCount int
+	var versionIndex string
+	var ids []string
 
 	for _, field := range t.Fields {
-		index := "$#"
-		if field.Value != nil {
-			argCount++
-			index = "$" + strconv.Itoa(argCount)
+		// ID fields are matched by their position in the arguments so they do not
+		// need to come first.
+		if field.ID {
+			ids = append(ids, t.ref()+"."+field.Name+" = "+field.bind(Value, argCount))
 		}
-		if field.Update != "" {
-			updates = append(updates, field.Name+" = "+strings.ReplaceAll(field.Update, Value, index))
+		if t.VersionColumn != "" && field.Name == t.VersionColumn {
+			// The version is matched against the current value and incremented.
+			versionIndex = field.bind(Value, argCount)
+			updates = append(updates, t.versionIncrement())
+		} else if field.update() != "" {
+			updates = append(updates, field.Name+" = "+field.bind(field.update(), argCount))
 		}
+		argCount += t.argCount(field, writeUpdate)
 	}
 
-	b.WriteString("WITH ")
-	b.WriteString(t.Table)
-	b.WriteString(" AS ( UPDATE ")
-	if t.Schema != "" {
-		b.WriteString(t.Schema)
-		b.WriteString(".")
-	}
-	b.WriteString(t.Table)
+	t.writeReturningStart(&b, returning)
+	b.WriteString("UPDATE ")
+	t.writeTableName(&b)
 	b.WriteString(" SET ")
 	b.WriteString(strings.Join(updates, ",")) // Updates
 	b.WriteString(` WHERE `)
-	var idIndex = 0
+	b.WriteString(strings.Join(ids, " AND "))
+	if versionIndex != "" {
+		t.writeVersionPredicate(&b, versionIndex)
+	}
+	t.writeSoftDeletePredicate(&b)
+	t.writeReturning(&b, returning)
+	return b.String()
+
+}
+
+// GenerateUpdateReturningOldQuery generates an update query like GenerateUpdateQuery
+// that also returns the record before the update. The row is locked and read in a
+// CTE before it is updated, the old fields are aliased under "old" and the updated
+// fields under "new", see UpdateResult. Only fields that can be scanned are returned.
+func (t *Table[T]) GenerateUpdateReturningOldQuery() (string, error) {
+
+	var returning []*Field[T]
+	var ids, join []string
+	var argCount int
 	for _, field := range t.Fields {
 		if field.ID {
-			idIndex++
-			if idIndex > 1 {
-				b.WriteString(` AND `)
-			}
-			b.WriteString(t.Table)
-			b.WriteString(".")
-			b.WriteString(field.Name)
-			b.WriteString(" = $")
-			b.WriteString(strconv.Itoa(idIndex))
+			ids = append(ids, t.ref()+"."+field.Name+" = "+field.bind(Value, argCount))
+			join = append(join, "old_row."+field.Name+" = new_row."+field.returnedName())
+		}
+		if t.scannable(field) {
+			returning = append(returning, field)
 		}
+		argCount += t.argCount(field, writeUpdate)
 	}
-	b.WriteString(" RETURNING *")
+	if len(ids) == 0 {
+		return "", ErrNoIDFields
+	}
+
+	var b strings.Builder
+	b.WriteString("WITH old_row AS (SELECT * FROM ")
+	t.writeTableName(&b)
+	b.WriteString(" WHERE ")
+	b.WriteString(strings.Join(ids, " AND "))
+	t.writeSoftDeletePredicate(&b)
+	b.WriteString(" FOR UPDATE), new_row AS (")
+	b.WriteString(t.generateUpdateQuery(returning))
 	b.WriteString(") SELECT ")
-	b.WriteString(t.SelectFields)
-	if t.SelectAdditionalFields != "" {
-		if t.SelectFields != "" {
+	for i, field := range returning {
+		if i > 0 {
 			b.WriteString(",")
 		}
-		b.WriteString(t.SelectAdditionalFields)
+		name := field.scanName()
+		b.WriteString(`old_row.` + field.Name + ` AS "old.` + name + `",`)
+		b.WriteString(`new_row.` + field.returnedName() + ` AS "new.` + name + `"`)
 	}
-	b.WriteString(" FROM ")
-	b.WriteString(t.Table)
-	if t.Joins != "" {
-		b.WriteString(" ")
-		b.WriteString(t.Joins)
+	b.WriteString(" FROM new_row JOIN old_row ON ")
+	b.WriteString(strings.Join(join, " AND "))
+	return b.String(), nil
+
+}
+
+// GenerateUpdateFieldsQuery generates an update query that only sets the named fields.
+// The ID fields are bound first starting at $1 followed by the named fields that
+// have a Value function in the order provided. If the table has a VersionColumn the
+// current version is bound last, it is matched like Update and incremented, so it
+// cannot be named.
+func (t *Table[T]) GenerateUpdateFieldsQuery(names ...string) (string, error) {
+	return t.generateUpdateFieldsQuery(nil, names...)
+}
+
+func (t *Table[T]) generateUpdateFieldsQuery(returning []*Field[T], names ...string) (string, error) {
+
+	fields, err := t.lookupFields(names...)
+	if err != nil {
+		return "", err
 	}
-	return b.String()
+
+	var argCount int
+	for _, field := range t.Fields {
+		if field.ID {
+			argCount++
+		}
+	}
+
+	var updates []string
+	for _, field := range fields {
+		switch {
+		case field.Generated:
+			return "", fmt.Errorf("field %s is generated and cannot be updated", field.Name)
+		case t.VersionColumn != "" && field.Name == t.VersionColumn:
+			return "", fmt.Errorf("field %s is the VersionColumn and is incremented by the update", field.Name)
+		case field.update() != "" && field.Value == nil && field.Values == nil && strings.Contains(field.update(), Value):
+			return "", fmt.Errorf("field %s binds %s but has no Value or Values", field.Name, Value)
+		case field.update() != "":
+			updates = append(updates, field.Name+" = "+field.bind(field.update(), argCount))
+		case field.Value != nil && field.Values == nil:
+			updates = append(updates, field.Name+" = "+field.bind(Value, argCount))
+		default:
+			return "", fmt.Errorf("field %s has no Update or Value", field.Name)
+		}
+		argCount += t.argCount(field, writeUpdateFields)
+	}
+	versionField, err := t.versionField()
+	if err != nil {
+		return "", err
+	}
+	if versionField != nil {
+		updates = append(updates, t.versionIncrement())
+	}
+
+	var b strings.Builder
+	t.writeReturningStart(&b, returning)
+	b.WriteString("UPDATE ")
+	t.writeTableName(&b)
+	b.WriteString(" SET ")
+	b.WriteString(strings.Join(updates, ",")) // Updates
+	b.WriteString(` WHERE `)
+	t.writeIDPredicate(&b)
+	if versionField != nil {
+		t.writeVersionPredicate(&b, versionField.bind(Value, argCount))
+	}
+	t.writeSoftDeletePredicate(&b)
+	t.writeReturning(&b, returning)
+	return b.String(), nil
 
 }
 
+// GenerateUpsertQuery generates an upsert query. The conflict target is every ID
+// field, so a table with a composite key generates ON CONFLICT (id1, id2) and
+// needs a primary key or unique index over those columns.
 func (t *Table[T]) GenerateUpsertQuery() string {
+	return t.generateUpsertQuery(nil)
+}
+
+// GenerateUpsertBatchQuery generates a multi-row upsert query for the given number of rows.
+// Each row binds the same arguments as an insert. On conflict, the Update value of each
+// field references the EXCLUDED row in place of the `Value` constant, fields without an
+// Insert are only updated if their Update does not reference it.
+func (t *Table[T]) GenerateUpsertBatchQuery(rows int) string {
+	return t.generateUpsertBatchQuery(rows, writeUpsertBatch, nil, upsertConflict{})
+}
+
+func (t *Table[T]) generateUpsertQuery(returning []*Field[T]) string {
+	return t.generateUpsertBatchQuery(1, writeUpsert, returning, upsertConflict{})
+}
+
+// upsertConflict configures the ON CONFLICT clause of a generated upsert.
+type upsertConflict struct {
+	// columns is the conflict target, defaults to the ID fields.
+	columns []string
+	// update limits the fields set on conflict, defaults to the fields with UpsertUpdate
+	// set, or the fields with an Update if there are none.
+	update []string
+	// where is the index predicate of the conflict target, needed to match a
+	// partial unique index.
+	where string
+	// doNothing ignores conflicting rows.
+	doNothing bool
+	// inserted returns the record fields nested under "record" with an inserted
+	// column reporting if the row was inserted rather than updated, see upsertedRow.
+	inserted bool
+}
+
+func (t *Table[T]) generateUpsertBatchQuery(rows int, op writeOp, returning []*Field[T], conflict upsertConflict) string {
 
 	var b strings.Builder
-	var names []string
-	var inserts []string
 	var updates []string
 	var argCount int
-	var ids []string
+	names, values := t.insertValues(rows, op)
+
+	ids := conflict.columns
+	if len(ids) == 0 {
+		for _, field := range t.Fields {
+			if field.ID {
+				ids = append(ids, field.Name)
+			}
+		}
+	}
+
+	if conflict.update == nil {
+		for _, field := range t.Fields {
+			if field.UpsertUpdate {
+				conflict.update = append(conflict.update, field.Name)
+			}
+		}
+	}
 
 	for _, field := range t.Fields {
-		index := "$#"
-		if field.Value != nil {
-			argCount++
-			index = "$" + strconv.Itoa(argCount)
+		// A single upsert references its own arguments, a batch uses the excluded row.
+		// Fields binding several arguments are set from the excluded row directly.
+		update := field.bind(field.update(), argCount)
+		if op == writeUpsertBatch {
+			switch {
+			case field.insert() == "" && strings.Contains(field.update(), Value):
+				update = ""
+			case field.Values != nil:
+				update = "EXCLUDED." + field.Name
+			default:
+				update = strings.ReplaceAll(field.update(), Value, "EXCLUDED."+field.Name)
+			}
 		}
-		if field.Insert != "" {
-			names = append(names, field.Name)
-			inserts = append(inserts, strings.ReplaceAll(field.Insert, Value, index))
+		argCount += t.argCount(field, op)
+		if conflict.update != nil {
+			if slices.Contains(conflict.update, field.Name) && !field.Generated {
+				if field.update() != "" && update != "" {
+					updates = append(updates, field.Name+" = "+update)
+				} else {
+					updates = append(updates, field.Name+" = EXCLUDED."+field.Name)
+				}
+			}
+		} else if field.update() != "" && update != "" {
+			updates = append(updates, field.Name+" = "+update)
 		}
-		if field.Update != "" {
-			updates = append(updates, field.Name+" = "+strings.ReplaceAll(field.Update, Value, index))
+	}
+
+	if !conflict.inserted {
+		t.writeReturningStart(&b, returning)
+	}
+	b.WriteString("INSERT INTO ")
+	t.writeTableName(&b)
+	b.WriteString(" (")
+	b.WriteString(strings.Join(names, ",")) // Fields
+	b.WriteString(") VALUES")
+	b.WriteString(strings.Join(values, ",")) // Inserts
+	b.WriteString(" ON CONFLICT (")          // ID Fields
+	b.WriteString(strings.Join(ids, ","))
+	b.WriteString(")")
+	if conflict.where != "" {
+		b.WriteString(" WHERE ")
+		b.WriteString(conflict.where)
+	}
+	if conflict.doNothing {
+		b.WriteString(" DO NOTHING")
+	} else {
+		b.WriteString(" DO UPDATE SET ")
+		b.WriteString(strings.Join(updates, ",")) // Updates
+	}
+	if conflict.inserted {
+		t.writeReturningInserted(&b, returning)
+	} else {
+		t.writeReturning(&b, returning)
+	}
+	return b.String()
+
+}
+
+func (t *Table[T]) GenerateSelectorQuery() string {
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	b.WriteString(t.SelectFields)
+	if t.SelectAdditionalFields != "" {
+		if t.SelectFields != "" {
+			b.WriteString(",")
 		}
+		b.WriteString(t.SelectAdditionalFields)
+	}
+	b.WriteString(` FROM `)
+	t.writeTableName(&b)
+	t.writeJoins(&b)
+	return b.String()
+}
+
+// GenerateSelectorWhere generates the condition always applied by the Selector.
+// It excludes soft deleted records if SoftDeleteColumn is set.
+func (t *Table[T]) GenerateSelectorWhere() string {
+	if t.SoftDeleteColumn == "" {
+		return ""
+	}
+	return t.ref() + "." + t.SoftDeleteColumn + " IS NULL"
+}
+
+// GenerateSelectorFields maps the field names to their columns for filtering and sorting.
+func (t *Table[T]) GenerateSelectorFields() map[string]string {
+	fields := make(map[string]string, len(t.Fields))
+	for _, field := range t.Fields {
+		fields[strings.Trim(field.Name, `"`)] = t.ref() + "." + field.Name
+	}
+	return fields
+}
+
+// GenerateSelectorIDs returns the ID columns used by the Selector as the final sort terms.
+func (t *Table[T]) GenerateSelectorIDs() []string {
+	var ids []string
+	for _, field := range t.Fields {
 		if field.ID {
-			ids = append(ids, field.Name)
+			ids = append(ids, t.ref()+"."+field.Name)
 		}
 	}
+	return ids
+}
 
+// writeReturningStart starts a write query. Unless specific returning fields are
+// requested, the write is wrapped in a CTE so the returned record can be selected
+// with the joins and additional fields.
+func (t *Table[T]) writeReturningStart(b *strings.Builder, returning []*Field[T]) {
+	if len(returning) > 0 {
+		return
+	}
 	b.WriteString("WITH ")
-	b.WriteString(t.Table)
-	b.WriteString(" AS ( INSERT INTO ")
-	if t.Schema != "" {
-		b.WriteString(t.Schema)
-		b.WriteString(".")
+	b.WriteString(t.ref())
+	b.WriteString(" AS ( ")
+}
+
+// writeReturning finishes a write query started with writeReturningStart.
+func (t *Table[T]) writeReturning(b *strings.Builder, returning []*Field[T]) {
+	if len(returning) > 0 {
+		b.WriteString(" RETURNING ")
+		for i, field := range returning {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(field.Name)
+			writeAlias(b, field.Alias)
+		}
+		return
 	}
-	b.WriteString(t.Table)
-	b.WriteString(" (")
-	b.WriteString(strings.Join(names, ",")) // Fields
-	b.WriteString(") VALUES(")
-	b.WriteString(strings.Join(inserts, ",")) // Inserts
-	b.WriteString(") ON CONFLICT (")          // ID Fields
-	b.WriteString(strings.Join(ids, ","))     // Inserts
-	b.WriteString(") DO UPDATE SET ")
-	b.WriteString(strings.Join(updates, ",")) // Updates
 	b.WriteString(" RETURNING *")
 	b.WriteString(") SELECT ")
 	b.WriteString(t.SelectFields)
@@ -368,30 +989,363 @@ func (t *Table[T]) GenerateUpsertQuery() string {
 		b.WriteString(t.SelectAdditionalFields)
 	}
 	b.WriteString(" FROM ")
+	b.WriteString(t.ref())
+	t.writeJoins(b)
+}
+
+// writeReturningInserted finishes an upsert returning the fields, or every field
+// that can be scanned if none are given, aliased under "record" followed by whether
+// the row was inserted. A row updated on conflict has a non zero xmax.
+func (t *Table[T]) writeReturningInserted(b *strings.Builder, returning []*Field[T]) {
+	if len(returning) == 0 {
+		for _, field := range t.Fields {
+			if t.scannable(field) {
+				returning = append(returning, field)
+			}
+		}
+	}
+	b.WriteString(" RETURNING ")
+	for _, field := range returning {
+		b.WriteString(field.Name)
+		b.WriteString(` AS "record.`)
+		b.WriteString(field.scanName())
+		b.WriteString(`",`)
+	}
+	b.WriteString("(xmax = 0) AS inserted")
+}
+
+// writeIDPredicate writes the ID field comparisons used in a WHERE clause. The
+// positional arguments start at $1 in the order the ID fields are declared.
+func (t *Table[T]) writeIDPredicate(b *strings.Builder) {
+	var idIndex int
+	for _, field := range t.Fields {
+		if field.ID {
+			idIndex++
+			if idIndex > 1 {
+				b.WriteString(` AND `)
+			}
+			b.WriteString(t.ref())
+			b.WriteString(".")
+			b.WriteString(field.Name)
+			b.WriteString(" = ")
+			b.WriteString(field.placeholder(idIndex))
+		}
+	}
+}
+
+// versionField returns the field of the VersionColumn, or nil if it is not set. It
+// returns an error if the field is missing or has no Value function.
+func (t *Table[T]) versionField() (*Field[T], error) {
+	if t.VersionColumn == "" {
+		return nil, nil
+	}
+	for _, field := range t.Fields {
+		if field.Name == t.VersionColumn {
+			if field.Value == nil {
+				return nil, fmt.Errorf("version field %s has no Value function", field.Name)
+			}
+			return field, nil
+		}
+	}
+	return nil, fmt.Errorf("version column %s is not a field", t.VersionColumn)
+}
+
+// versionIncrement returns the assignment incrementing the VersionColumn.
+func (t *Table[T]) versionIncrement() string {
+	return t.VersionColumn + " = " + t.ref() + "." + t.VersionColumn + " + 1"
+}
+
+// writeVersionPredicate writes the condition matching the VersionColumn to the
+// current version bound to placeholder.
+func (t *Table[T]) writeVersionPredicate(b *strings.Builder, placeholder string) {
+	b.WriteString(` AND `)
+	b.WriteString(t.ref())
+	b.WriteString(".")
+	b.WriteString(t.VersionColumn)
+	b.WriteString(" = ")
+	b.WriteString(placeholder)
+}
+
+// writeSoftDeletePredicate excludes soft deleted records if SoftDeleteColumn is set.
+func (t *Table[T]) writeSoftDeletePredicate(b *strings.Builder) {
+	if t.SoftDeleteColumn == "" {
+		return
+	}
+	b.WriteString(` AND `)
+	b.WriteString(t.ref())
+	b.WriteString(".")
+	b.WriteString(t.SoftDeleteColumn)
+	b.WriteString(` IS NULL`)
+}
+
+// GenerateExistsQuery generates a query checking if a record exists by ID.
+func (t *Table[T]) GenerateExistsQuery() string {
+	var b strings.Builder
+	b.WriteString(`SELECT EXISTS(SELECT 1 FROM `)
+	t.writeTableName(&b)
+	b.WriteString(` WHERE `)
+	t.writeIDPredicate(&b)
+	t.writeSoftDeletePredicate(&b)
+	b.WriteString(`)`)
+	return b.String()
+}
+
+// generateSoftDeletedByFieldsQuery generates a query checking if a soft deleted
+// record matches the fields, bound from $1 in order.
+func (t *Table[T]) generateSoftDeletedByFieldsQuery(fields ...string) string {
+	var b strings.Builder
+	b.WriteString(`SELECT EXISTS(SELECT 1 FROM `)
+	t.writeTableName(&b)
+	b.WriteString(` WHERE `)
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteString(` AND `)
+		}
+		b.WriteString(t.ref())
+		b.WriteString(".")
+		b.WriteString(field)
+		b.WriteString(" = $")
+		b.WriteString(strconv.Itoa(i + 1))
+	}
+	b.WriteString(` AND `)
+	b.WriteString(t.ref())
+	b.WriteString(".")
+	b.WriteString(t.SoftDeleteColumn)
+	b.WriteString(` IS NOT NULL)`)
+	return b.String()
+}
+
+// GenerateCountQuery generates a query counting the records matching whereClause.
+// If whereClause is empty, all records are counted. Soft deleted records are not
+// counted if the table has a SoftDeleteColumn.
+func (t *Table[T]) GenerateCountQuery(whereClause string) string {
+	var b strings.Builder
+	b.WriteString(`SELECT COUNT(*) FROM `)
+	t.writeTableName(&b)
+	t.writeJoins(&b)
+	switch {
+	case whereClause != "":
+		b.WriteString(` WHERE (`)
+		b.WriteString(whereClause)
+		b.WriteString(`)`)
+		t.writeSoftDeletePredicate(&b)
+	case t.SoftDeleteColumn != "":
+		b.WriteString(` WHERE TRUE`)
+		t.writeSoftDeletePredicate(&b)
+	}
+	return b.String()
+}
+
+// CreateTableDDL generates a CREATE TABLE IF NOT EXISTS statement for the table from
+// the Fields, for example to bootstrap a test database. Every field must have a
+// PgType. The ID fields are the primary key and the SoftDeleteColumn is added as a
+// timestamptz if it is not one of the fields. Indexes and constraints other than the
+// primary key and NotNull are not generated.
+func (t *Table[T]) CreateTableDDL() (string, error) {
+
+	var b strings.Builder
+	b.WriteString("CREATE TABLE IF NOT EXISTS ")
+	if t.Schema != "" {
+		b.WriteString(t.Schema)
+		b.WriteByte('.')
+	}
 	b.WriteString(t.Table)
-	if t.Joins != "" {
+	b.WriteString(" (")
+
+	var ids []string
+	softDelete := t.SoftDeleteColumn != ""
+	for i, field := range t.Fields {
+		if field.PgType == "" {
+			return "", fmt.Errorf("field %s has no PgType", field.Name)
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(field.Name)
 		b.WriteString(" ")
-		b.WriteString(t.Joins)
+		b.WriteString(field.PgType)
+		if field.ID || field.NotNull {
+			b.WriteString(" NOT NULL")
+		}
+		if field.ID {
+			ids = append(ids, field.Name)
+		}
+		if field.Name == t.SoftDeleteColumn {
+			softDelete = false
+		}
 	}
-	return b.String()
+	if softDelete {
+		if len(t.Fields) > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(t.SoftDeleteColumn)
+		b.WriteString(" timestamptz")
+	}
+	if len(ids) > 0 {
+		b.WriteString(", PRIMARY KEY (")
+		b.WriteString(strings.Join(ids, ","))
+		b.WriteString(")")
+	}
+	b.WriteString(")")
+	return b.String(), nil
 
 }
 
-func (t *Table[T]) GenerateSelectorQuery() string {
+// writeOp is a statement the positional arguments of the fields are bound for.
+type writeOp int
+
+const (
+	writeInsert writeOp = iota
+	writeUpdate
+	writeUpsert
+	writeUpsertBatch
+	writeUpdateFields
+)
+
+// argCount returns the number of positional arguments the field binds in the
+// statement, which is zero unless its expression references the Value constant.
+// The expression is the Insert for an insert or batch upsert and the Update for
+// an update, except an ID or the VersionColumn is always bound. An upsert uses
+// the Insert if it references the Value constant and the Update otherwise, and
+// UpdateFields binds every named field. A field with a Values function binds one
+// argument for each Value constant in its expression.
+func (t *Table[T]) argCount(field *Field[T], op writeOp) int {
+
+	var expr string
+	switch op {
+	case writeInsert, writeUpsertBatch:
+		expr = field.insert()
+	case writeUpdate:
+		if field.ID || (t.VersionColumn != "" && field.Name == t.VersionColumn) {
+			expr = Value
+		} else {
+			expr = field.update()
+		}
+	case writeUpsert:
+		expr = field.insert()
+		if !strings.Contains(expr, Value) {
+			expr = field.update()
+		}
+	case writeUpdateFields:
+		expr = field.update()
+		if expr == "" && !field.Generated {
+			expr = Value
+		}
+	}
+	switch {
+	case !strings.Contains(expr, Value):
+		return 0
+	case field.Values != nil:
+		return strings.Count(expr, Value)
+	case field.Value != nil:
+		return 1
+	}
+	return 0
+
+}
+
+// bind replaces the Value constants in expr with the positional arguments of the
+// field, which start after argCount. With a Value function every constant references
+// the same argument, with a Values function each references the next argument.
+func (f *Field[T]) bind(expr string, argCount int) string {
+	if f.Values == nil {
+		if f.Value == nil {
+			return expr
+		}
+		return strings.ReplaceAll(expr, Value, f.placeholder(argCount+1))
+	}
+	parts := strings.Split(expr, Value)
 	var b strings.Builder
-	b.WriteString("SELECT ")
-	b.WriteString(t.SelectFields)
-	if t.SelectAdditionalFields != "" {
-		if t.SelectFields != "" {
-			b.WriteString(",")
+	for i, part := range parts {
+		if i > 0 {
+			b.WriteString("$" + strconv.Itoa(argCount+i))
 		}
-		b.WriteString(t.SelectAdditionalFields)
+		b.WriteString(part)
 	}
-	b.WriteString(` FROM `)
-	b.WriteString(t.Table)
+	return b.String()
+}
+
+// lookupFields returns the fields with the given names in the same order. The
+// names may be provided with or without quotes.
+func (t *Table[T]) lookupFields(names ...string) ([]*Field[T], error) {
+	var fields []*Field[T]
+	var unknown []string
+	for _, name := range names {
+		var found *Field[T]
+		for _, field := range t.Fields {
+			if strings.Trim(field.Name, `"`) == strings.Trim(name, `"`) {
+				found = field
+				break
+			}
+		}
+		if found == nil {
+			unknown = append(unknown, name)
+			continue
+		}
+		fields = append(fields, found)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown fields: %s", strings.Join(unknown, ", "))
+	}
+	return fields, nil
+}
+
+// Column returns the qualified column of the named field for use in ad-hoc queries,
+// for example in the whereClause of Count or DeleteByQuery. The column is qualified
+// with the Alias if set, otherwise with the Schema and Table.
+func (t *Table[T]) Column(fieldName string) (string, error) {
+	fields, err := t.lookupFields(fieldName)
+	if err != nil {
+		return "", err
+	}
+	return t.column(fields[0]), nil
+}
+
+// Columns returns the qualified columns of all the fields in order.
+func (t *Table[T]) Columns() []string {
+	columns := make([]string, 0, len(t.Fields))
+	for _, field := range t.Fields {
+		columns = append(columns, t.column(field))
+	}
+	return columns
+}
+
+func (t *Table[T]) column(field *Field[T]) string {
+	if t.Alias == "" && t.Schema != "" {
+		return t.Schema + "." + t.Table + "." + field.Name
+	}
+	return t.ref() + "." + field.Name
+}
+
+// ref returns the name used to reference the table in queries, the Alias if set.
+func (t *Table[T]) ref() string {
+	if t.Alias != "" {
+		return t.Alias
+	}
+	return t.Table
+}
+
+// writeJoins writes the Joins followed by the StructuredJoins.
+func (t *Table[T]) writeJoins(b *strings.Builder) {
 	if t.Joins != "" {
 		b.WriteString(" ")
 		b.WriteString(t.Joins)
 	}
-	return b.String()
+	for _, join := range t.StructuredJoins {
+		b.WriteString(" ")
+		b.WriteString(join.String())
+	}
+}
+
+// writeTableName writes the schema qualified table name and alias.
+func (t *Table[T]) writeTableName(b *strings.Builder) {
+	if t.Schema != "" {
+		b.WriteString(t.Schema)
+		b.WriteByte('.')
+	}
+	b.WriteString(t.Table)
+	if t.Alias != "" {
+		b.WriteString(" AS ")
+		b.WriteString(t.Alias)
+	}
 }
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"context"
+)
+
+// Tracer starts a span for each Table operation. It is nil by default so no spans
+// are created. An OpenTelemetry tracer can be adapted by starting a span with the
+// attributes and setting the error and status in End.
+var Tracer QueryTracer
+
+// QueryTracer starts spans named postgres.<op> with the db.system and db.sql.table
+// attributes, and request.id if RequestIDKey is set.
+type QueryTracer interface {
+	Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span)
+}
+
+// Span is a span started by a QueryTracer.
+type Span interface {
+	// SetAttribute is called with db.statement once the query is known. Queries
+	// generated by a Table only reference arguments by position, queries passed
+	// to GetByQuery should be sanitized by the implementation if needed.
+	SetAttribute(key, value string)
+	// End ends the span, recording err if it is not nil.
+	End(err error)
+}
+
+// noopSpan is used when there is no Tracer.
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key, value string) {}
+func (noopSpan) End(err error)                  {}
+
+// startSpan starts a span for the operation if Tracer is set.
+func (t *Table[T]) startSpan(ctx context.Context, op string) (context.Context, Span) {
+	if Tracer == nil {
+		return ctx, noopSpan{}
+	}
+	attrs := map[string]string{
+		"db.system":    "postgresql",
+		"db.sql.table": t.qualifiedName(),
+	}
+	if id := requestID(ctx); id != "" {
+		attrs["request.id"] = id
+	}
+	return Tracer.Start(ctx, "postgres."+op, attrs)
+}
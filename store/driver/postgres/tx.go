@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// InTx runs fn inside a transaction. The transaction is committed if fn returns
+// nil and rolled back if it returns an error or panics. A panic is re-raised
+// after the rollback.
+func InTx(ctx context.Context, db *sqlx.DB, fn func(tx DB) error) error {
+	return InTxWithOpts(ctx, db, nil, fn)
+}
+
+// InTxWithOpts is InTx with sql.TxOptions to set the isolation level or read only.
+func InTxWithOpts(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, fn func(tx DB) error) error {
+
+	tx, err := db.BeginTxx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", WrapError(err))
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return fmt.Errorf("%w (rollback error: %v)", err, rerr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %w", WrapError(err))
+	}
+	return nil
+
+}
+
+// savepoints numbers the savepoints created by NestedTx so their names are unique.
+var savepoints atomic.Int64
+
+// Transactional is implemented by DBs that know whether they run in a transaction,
+// such as PgxDB and wrappers like CircuitBreakerDB that forward to the DB they wrap.
+type Transactional interface {
+	InTransaction() bool
+}
+
+// inTransaction returns true if db is a *sqlx.Tx or a Transactional in a transaction.
+func inTransaction(db DB) bool {
+	switch db := db.(type) {
+	case *sqlx.Tx:
+		return true
+	case Transactional:
+		return db.InTransaction()
+	}
+	return false
+}
+
+// NestedTx runs fn inside a transaction like InTx so it can be composed with
+// callers that may already be in one. If db is a *sqlx.DB a transaction is begun,
+// if db is a transaction, a *sqlx.Tx or a Transactional in one, fn runs inside a
+// savepoint that is released if fn returns nil and rolled back to if it returns an
+// error or panics. Any other db is an error.
+func NestedTx(ctx context.Context, db DB, fn func(tx DB) error) error {
+
+	if sqlDB, ok := db.(*sqlx.DB); ok {
+		return InTx(ctx, sqlDB, fn)
+	}
+	if !inTransaction(db) {
+		return fmt.Errorf("NestedTx needs a *sqlx.DB or a transaction, got %T", db)
+	}
+
+	name := "nested_tx_" + strconv.FormatInt(savepoints.Add(1), 10)
+	if err := Savepoint(ctx, db, name); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = RollbackTo(ctx, db, name)
+			panic(p)
+		}
+	}()
+
+	if err := fn(db); err != nil {
+		if rerr := RollbackTo(ctx, db, name); rerr != nil {
+			return fmt.Errorf("%w (rollback error: %v)", err, rerr)
+		}
+		return err
+	}
+
+	return ReleaseSavepoint(ctx, db, name)
+
+}
+
+// Savepoint creates a savepoint with the name in the transaction tx.
+func Savepoint(ctx context.Context, tx DB, name string) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+pq.QuoteIdentifier(name)); err != nil {
+		return fmt.Errorf("could not create savepoint %s: %w", name, WrapError(err))
+	}
+	return nil
+}
+
+// RollbackTo rolls back the transaction tx to the savepoint with the name. The
+// savepoint remains and can be rolled back to again.
+func RollbackTo(ctx context.Context, tx DB, name string) error {
+	if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+pq.QuoteIdentifier(name)); err != nil {
+		return fmt.Errorf("could not roll back to savepoint %s: %w", name, WrapError(err))
+	}
+	return nil
+}
+
+// ReleaseSavepoint releases the savepoint with the name in the transaction tx,
+// keeping the changes made since it was created.
+func ReleaseSavepoint(ctx context.Context, tx DB, name string) error {
+	if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+pq.QuoteIdentifier(name)); err != nil {
+		return fmt.Errorf("could not release savepoint %s: %w", name, WrapError(err))
+	}
+	return nil
+}
@@ -7,6 +7,20 @@ import (
 
 var ErrNotFound = errors.New("not found")
 
+// ErrConcurrentModification is returned when a record was changed by someone else since it was read.
+var ErrConcurrentModification = errors.New("concurrent modification")
+
+// ErrTimeout is returned when the database cancelled a statement, for example because
+// it exceeded the statement timeout, as opposed to the caller's context being done.
+var ErrTimeout = errors.New("statement timeout")
+
+// ErrDeadlock is returned when a transaction was aborted to resolve a deadlock. It can be retried.
+var ErrDeadlock = errors.New("deadlock detected")
+
+// ErrSerialization is returned when a transaction could not be serialized with concurrent
+// transactions. It can be retried.
+var ErrSerialization = errors.New("serialization failure")
+
 type ErrorType int
 type ErrorOp int
 
@@ -49,6 +63,23 @@ func (e *Error) ErrorForOp(op ErrorOp) error {
 	return e.Err
 }
 
+// ConstraintError is returned when a write violates a database constraint. It
+// unwraps to an *Error of the same Type.
+type ConstraintError struct {
+	Type       ErrorType
+	Constraint string
+	Column     string
+	Err        error
+}
+
+func (e *ConstraintError) Error() string { return e.Err.Error() }
+
+func (e *ConstraintError) Unwrap() error { return &Error{Type: e.Type, Err: e.Err} }
+
+func (e *ConstraintError) ErrorForOp(op ErrorOp) error {
+	return (&Error{Type: e.Type, Err: e.Err}).ErrorForOp(op)
+}
+
 type Results struct {
 	Count   *int64      `json:"count,omitempty"`
 	Results interface{} `json:"results"`